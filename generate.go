@@ -0,0 +1,249 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+
+	"src.agwa.name/depproxy/internal"
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+type generatedEntry struct {
+	needed    bool // true if the module's content is needed, not just its go.mod file
+	zipHash   string
+	goModHash string
+}
+
+type generatedAllowlist map[module.Version]*generatedEntry
+
+func (g generatedAllowlist) entry(mod module.Version) *generatedEntry {
+	if g[mod] == nil {
+		g[mod] = new(generatedEntry)
+	}
+	return g[mod]
+}
+
+func (g generatedAllowlist) addReplace(replace *modfile.Replace) {
+	if replace.New.Version != "" { // not a local directory replacement
+		g.entry(replace.New).needed = true
+	}
+}
+
+func (g generatedAllowlist) readModFile(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return simplifyError(err)
+	}
+	file, err := modfile.Parse(filename, data, nil)
+	if err != nil {
+		return err
+	}
+	for _, require := range file.Require {
+		g.entry(require.Mod).needed = true
+	}
+	for _, replace := range file.Replace {
+		g.addReplace(replace)
+	}
+	return nil
+}
+
+func (g generatedAllowlist) readSumFile(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return simplifyError(err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		f := strings.Fields(scanner.Text())
+		if len(f) == 0 {
+			continue
+		} else if len(f) != 3 {
+			return fmt.Errorf("%s:%d: malformed go.sum line", filename, lineno)
+		}
+		if version, isGoMod := strings.CutSuffix(f[1], "/go.mod"); isGoMod {
+			g.entry(module.Version{Path: f[0], Version: version}).goModHash = f[2]
+		} else {
+			entry := g.entry(module.Version{Path: f[0], Version: f[1]})
+			entry.needed = true
+			entry.zipHash = f[2]
+		}
+	}
+	return scanner.Err()
+}
+
+func (g generatedAllowlist) readWorkFile(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return simplifyError(err)
+	}
+	file, err := modfile.ParseWork(filename, data, nil)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(filename)
+	for _, use := range file.Use {
+		useDir := use.Path
+		if !filepath.IsAbs(useDir) {
+			useDir = filepath.Join(dir, useDir)
+		}
+		if err := g.readModFile(filepath.Join(useDir, "go.mod")); err != nil {
+			return err
+		}
+		if err := g.readSumFileIfExists(filepath.Join(useDir, "go.sum")); err != nil {
+			return err
+		}
+	}
+	for _, replace := range file.Replace {
+		g.addReplace(replace)
+	}
+	return g.readSumFileIfExists(filepath.Join(dir, "go.work.sum"))
+}
+
+func (g generatedAllowlist) readSumFileIfExists(filename string) error {
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return nil
+	}
+	return g.readSumFile(filename)
+}
+
+func (g generatedAllowlist) readFile(filename string) error {
+	switch {
+	case strings.HasSuffix(filename, ".sum"):
+		return g.readSumFile(filename)
+	case strings.HasSuffix(filename, ".work"):
+		return g.readWorkFile(filename)
+	default:
+		return g.readModFile(filename)
+	}
+}
+
+// lines returns the allowlist lines for every needed module version which is not already
+// allowed by existing, sorted by module path and version
+func (g generatedAllowlist) lines(existing *depproxy.Allowlist, includeHashes bool) []string {
+	mods := make([]module.Version, 0, len(g))
+	for mod, entry := range g {
+		if !entry.needed || existing.IsAllowed(goproxy.ModulePath(mod.Path), goproxy.ModuleVersion(mod.Version)) {
+			continue
+		}
+		mods = append(mods, mod)
+	}
+	slices.SortFunc(mods, func(a, b module.Version) int {
+		return cmp.Or(cmp.Compare(a.Path, b.Path), semver.Compare(a.Version, b.Version))
+	})
+
+	var lines []string
+	for _, mod := range mods {
+		entry := g[mod]
+		path := goproxy.ModulePath(mod.Path)
+		if includeHashes {
+			lines = append(lines, depproxy.FormatAllowlistLine(path, mod.Version, entry.zipHash, entry.goModHash))
+		} else {
+			lines = append(lines, depproxy.FormatAllowlistLine(path, mod.Version, "", ""))
+		}
+	}
+	return lines
+}
+
+func generateAllowlistMain(args []string) {
+	var flags struct {
+		hashes bool
+		merge  string
+		output string
+	}
+	flagSet := flag.NewFlagSet("allowlist generate", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: %s allowlist generate [flags] FILE...\n", os.Args[0])
+		fmt.Fprintf(flagSet.Output(), "Generate an allowlist from the given go.mod, go.sum, and go.work files\n")
+		flagSet.PrintDefaults()
+	}
+	flagSet.BoolVar(&flags.hashes, "hashes", false, "Pin the hashes found in go.sum files")
+	flagSet.StringVar(&flags.merge, "merge", "", "Path to existing allowlist to merge into; its contents are preserved and only versions it does not already allow are added")
+	flagSet.StringVar(&flags.output, "o", "", "Path to write allowlist to (default stdout); may be the same as -merge")
+	flagSet.Parse(args)
+
+	if flagSet.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "At least one go.mod, go.sum, or go.work file required")
+		flagSet.Usage()
+		os.Exit(2)
+	}
+
+	generated := make(generatedAllowlist)
+	for _, filename := range flagSet.Args() {
+		if err := generated.readFile(filename); err != nil {
+			fmt.Fprintf(os.Stderr, "error reading %q: %s\n", filename, err)
+			os.Exit(1)
+		}
+	}
+
+	var content []byte
+	var existingModules []depproxy.AllowedModule
+	if flags.merge != "" {
+		var err error
+		content, err = os.ReadFile(flags.merge)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading allowlist file from %q: %s\n", flags.merge, simplifyError(err))
+			os.Exit(1)
+		}
+		existingModules, err = depproxy.ReadAllowedModules(bytes.NewReader(content))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading allowlist file from %q: %s\n", flags.merge, err)
+			os.Exit(1)
+		}
+	}
+	content = depproxy.InsertAllowlistLines(content, generated.lines(depproxy.CompileAllowlist(existingModules), flags.hashes))
+
+	if flags.output == "" {
+		os.Stdout.Write(content)
+	} else if err := depproxy.WriteAllowlistFile(flags.output, content); err != nil {
+		fmt.Fprintf(os.Stderr, "error writing allowlist file to %q: %s\n", flags.output, err)
+		os.Exit(1)
+	}
+}
+
+func allowlistMain(args []string) {
+	if len(args) == 0 || args[0] != "generate" {
+		fmt.Fprintf(os.Stderr, "Usage: %s allowlist generate [flags] FILE...\n", os.Args[0])
+		os.Exit(2)
+	}
+	generateAllowlistMain(args[1:])
+}
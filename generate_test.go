@@ -0,0 +1,166 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"src.agwa.name/depproxy/internal"
+)
+
+const (
+	testZipHash   = "h1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+	testGoModHash = "h1:BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBA="
+)
+
+func writeTestFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestGenerateAllowlist(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"go.mod": `module example.com/app
+
+require (
+	example.com/b v1.2.0
+	example.com/a v1.10.0
+	example.com/a v1.9.0 // indirect
+)
+
+replace example.com/old => example.com/new v0.1.0
+
+replace example.com/local => ./local
+`,
+		"go.sum": `example.com/a v1.10.0 ` + testZipHash + `
+example.com/a v1.10.0/go.mod ` + testGoModHash + `
+example.com/c v1.0.0/go.mod ` + testGoModHash + `
+`,
+		"go.work": `go 1.22
+
+use ./sub
+`,
+		"sub/go.mod": `module example.com/app/sub
+
+require example.com/d v0.3.0
+`,
+		"sub/go.sum": `example.com/d v0.3.0 ` + testZipHash + `
+`,
+		"go.work.sum": `example.com/e v1.0.0 ` + testZipHash + `
+`,
+	})
+
+	tests := []struct {
+		name          string
+		files         []string
+		existing      string
+		includeHashes bool
+		want          []string
+	}{
+		{
+			name:  "go.mod",
+			files: []string{"go.mod"},
+			want: []string{
+				"example.com/a\tv1.9.0",
+				"example.com/a\tv1.10.0",
+				"example.com/b\tv1.2.0",
+				"example.com/new\tv0.1.0",
+			},
+		},
+		{
+			name:          "go.sum with hashes",
+			files:         []string{"go.sum"},
+			includeHashes: true,
+			want: []string{
+				"example.com/a\tv1.10.0\t" + testZipHash + "\t" + testGoModHash,
+			},
+		},
+		{
+			name:  "go.sum without hashes",
+			files: []string{"go.sum"},
+			want: []string{
+				"example.com/a\tv1.10.0",
+			},
+		},
+		{
+			name:          "go.work",
+			files:         []string{"go.work"},
+			includeHashes: true,
+			want: []string{
+				"example.com/d\tv0.3.0\t" + testZipHash,
+				"example.com/e\tv1.0.0\t" + testZipHash,
+			},
+		},
+		{
+			name:     "merge",
+			files:    []string{"go.mod", "go.sum"},
+			existing: "example.com/a v1.9.0\nexample.com/* v1.2.*\n",
+			want: []string{
+				"example.com/a\tv1.10.0",
+				"example.com/new\tv0.1.0",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			generated := make(generatedAllowlist)
+			for _, file := range test.files {
+				if err := generated.readFile(filepath.Join(dir, file)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			existingModules, err := depproxy.ReadAllowedModules(strings.NewReader(test.existing))
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := generated.lines(depproxy.CompileAllowlist(existingModules), test.includeHashes)
+			if !slices.Equal(lines, test.want) {
+				t.Errorf("got lines:\n%s\nwant:\n%s", strings.Join(lines, "\n"), strings.Join(test.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestGenerateAllowlistMalformedSumFile(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{"go.sum": "example.com/a v1.0.0\n"})
+	if err := make(generatedAllowlist).readFile(filepath.Join(dir, "go.sum")); err == nil {
+		t.Errorf("readFile succeeded on malformed go.sum file")
+	}
+}
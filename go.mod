@@ -3,13 +3,13 @@ module src.agwa.name/depproxy
 go 1.24.4
 
 require (
+	golang.org/x/crypto v0.39.0
 	golang.org/x/mod v0.25.0
 	golang.org/x/sync v0.15.0
 	src.agwa.name/go-listener v0.7.0
 )
 
 require (
-	golang.org/x/crypto v0.39.0 // indirect
 	golang.org/x/net v0.41.0 // indirect
 	golang.org/x/text v0.26.0 // indirect
 )
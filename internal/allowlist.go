@@ -29,8 +29,9 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"path"
+	"strconv"
 	"strings"
+	"time"
 
 	"src.agwa.name/depproxy/internal/goproxy"
 )
@@ -38,25 +39,101 @@ import (
 type AllowedModule struct {
 	// Exactly one of Path and PathPattern are set
 	Path        goproxy.ModulePath
-	PathPattern string                // if set, is a valid path.Pattern
-	Version     goproxy.ModuleVersion // if not set, all versions are allowed
+	PathPattern string // if set, is a valid module path pattern (see pathpattern.go)
+
+	// At most one of Version and VersionConstraint are set; if neither is set, all versions are allowed.
+	// When PathPattern is set, the version applies independently to every module matching the pattern.
+	Version           goproxy.ModuleVersion // if set, only this exact version is allowed
+	VersionConstraint *VersionConstraint    // if set, versions satisfying this constraint are allowed
+
+	// If set, Path and Version are also set, and the module's zip file or go.mod file must have this hash (in go.sum form)
+	ZipHash   string
+	GoModHash string
+
+	// If true, this entry denies, rather than allows, matching module versions.
+	// Denies take precedence over allows.
+	Deny bool
+
+	// If set, overrides Server.MinAge for versions allowed by this entry
+	MinAge *time.Duration
+
+	// The number of the line in the allowlist file containing this entry, or 0 if unknown
+	Line int
 }
 
-func (module *AllowedModule) matchesPath(modulePath goproxy.ModulePath) bool {
+// String returns the entry's module path and version in allowlist syntax, without any hash or options
+func (module *AllowedModule) String() string {
+	var str string
+	if module.Deny {
+		str = "!"
+	}
 	if module.Path.IsSet() {
-		return module.Path == modulePath
+		str += module.Path.String()
+	} else {
+		str += module.PathPattern
+	}
+	if module.Version.IsSet() {
+		str += " " + module.Version.String()
+	} else if module.VersionConstraint != nil {
+		str += " " + module.VersionConstraint.String()
 	} else {
-		matched, _ := path.Match(module.PathPattern, modulePath.String())
-		return matched
+		str += " *"
+	}
+	return str
+}
+
+// ParseAge parses a duration in time.ParseDuration format, or a number of days followed by "d"
+func ParseAge(str string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(str, "d"); ok {
+		n, err := strconv.ParseUint(days, 10, 16)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number of days %q", days)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	age, err := time.ParseDuration(str)
+	if err != nil {
+		return 0, err
+	} else if age < 0 {
+		return 0, fmt.Errorf("age %q is negative", str)
+	}
+	return age, nil
+}
+
+// isOption reports whether the allowlist field is an option of the form name=value
+func isOption(field string) bool {
+	name, _, found := strings.Cut(field, "=")
+	if !found || name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z') && c != '-' {
+			return false
+		}
 	}
+	return true
 }
 
-func (m *AllowedModule) matchesVersion(version goproxy.ModuleVersion) bool {
-	return m.Version.IsEmpty() || m.Version == version
+func (module *AllowedModule) setOption(option string) error {
+	name, value, _ := strings.Cut(option, "=")
+	switch name {
+	case "min-age":
+		if module.Deny {
+			return fmt.Errorf("min-age cannot be specified on a deny line")
+		}
+		age, err := ParseAge(value)
+		if err != nil {
+			return fmt.Errorf("invalid min-age: %w", err)
+		}
+		module.MinAge = &age
+	default:
+		return fmt.Errorf("unknown option %q", name)
+	}
+	return nil
 }
 
-func (m *AllowedModule) matches(path goproxy.ModulePath, version goproxy.ModuleVersion) bool {
-	return m.matchesPath(path) && m.matchesVersion(version)
+func isExactVersion(str string) bool {
+	return strings.HasPrefix(str, "v") && !strings.Contains(str, "*")
 }
 
 func ReadAllowedModules(r io.Reader) ([]AllowedModule, error) {
@@ -74,14 +151,48 @@ func ReadAllowedModules(r io.Reader) ([]AllowedModule, error) {
 		f := strings.Fields(line)
 		if len(f) == 0 {
 			continue
-		} else if len(f) != 2 {
-			return nil, fmt.Errorf("syntax error on line %d: two fields expected, but %d provided", lineno, len(f))
+		} else if len(f) < 2 {
+			return nil, fmt.Errorf("syntax error on line %d: at least two fields expected, but %d provided", lineno, len(f))
+		}
+
+		var options []string
+		for len(f) > 2 && isOption(f[len(f)-1]) {
+			options = append(options, f[len(f)-1])
+			f = f[:len(f)-1]
+		}
+
+		// The zip hash may be followed by the go.mod hash, or a version with a /go.mod
+		// suffix may be followed by just the go.mod hash, as in go.sum
+		var hashes []string
+		for len(f) > 2 && strings.HasPrefix(f[len(f)-1], "h1:") {
+			if err := checkHash(f[len(f)-1]); err != nil {
+				return nil, fmt.Errorf("syntax error on line %d: %w", lineno, err)
+			}
+			hashes = append([]string{f[len(f)-1]}, hashes...)
+			f = f[:len(f)-1]
+		}
+		var isGoModHash bool
+		if len(hashes) > 0 {
+			if len(f) != 2 || !isExactVersion(f[1]) {
+				return nil, fmt.Errorf("error on line %d: a hash can only be specified with an exact version", lineno)
+			}
+			f[1], isGoModHash = strings.CutSuffix(f[1], "/go.mod")
+			if len(hashes) > 2 || (isGoModHash && len(hashes) > 1) {
+				return nil, fmt.Errorf("error on line %d: too many hashes specified", lineno)
+			}
 		}
 
-		var module AllowedModule
-		if strings.Contains(f[0], "*") {
-			if _, err := path.Match(f[0], ""); err != nil {
-				return nil, fmt.Errorf("syntax error on line %d: module path pattern is invalid", lineno)
+		module := AllowedModule{Line: lineno}
+		if pattern, isDeny := strings.CutPrefix(f[0], "!"); isDeny {
+			if len(hashes) > 0 {
+				return nil, fmt.Errorf("error on line %d: a hash cannot be specified on a deny line", lineno)
+			}
+			module.Deny = true
+			f[0] = pattern
+		}
+		if isPathPattern(f[0]) {
+			if err := checkPathPattern(f[0]); err != nil {
+				return nil, fmt.Errorf("syntax error on line %d: module path pattern is invalid: %w", lineno, err)
 			}
 			module.PathPattern = f[0]
 		} else {
@@ -92,16 +203,37 @@ func ReadAllowedModules(r io.Reader) ([]AllowedModule, error) {
 			module.Path = modulePath
 		}
 
-		if f[1] != "*" {
+		if len(f) == 2 && f[1] == "*" {
+			// all versions are allowed
+		} else if len(f) == 2 && isExactVersion(f[1]) {
 			moduleVersion, err := goproxy.MakeModuleVersion(f[1])
 			if err != nil {
 				return nil, fmt.Errorf("syntax error on line %d: %w", lineno, err)
 			}
 			module.Version = moduleVersion
+		} else {
+			constraint, err := ParseVersionConstraint(f[1:])
+			if err != nil {
+				return nil, fmt.Errorf("syntax error on line %d: %w", lineno, err)
+			}
+			module.VersionConstraint = constraint
 		}
 
-		if module.PathPattern != "" && module.Version.IsSet() {
-			return nil, fmt.Errorf("error on line %d: version must be '*' when a path pattern is used", lineno)
+		if len(hashes) > 0 && module.PathPattern != "" {
+			return nil, fmt.Errorf("error on line %d: a hash cannot be specified when a path pattern is used", lineno)
+		} else if isGoModHash {
+			module.GoModHash = hashes[0]
+		} else if len(hashes) > 0 {
+			module.ZipHash = hashes[0]
+			if len(hashes) > 1 {
+				module.GoModHash = hashes[1]
+			}
+		}
+
+		for _, option := range options {
+			if err := module.setOption(option); err != nil {
+				return nil, fmt.Errorf("error on line %d: %w", lineno, err)
+			}
 		}
 
 		modules = append(modules, module)
@@ -0,0 +1,217 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+func TestReadAllowedModulesHashes(t *testing.T) {
+	const goModHash = "h1:BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBA="
+	tests := []struct {
+		line          string
+		wantZipHash   string
+		wantGoModHash string
+		wantErr       bool
+	}{
+		{line: "example.com/m v1.0.0 " + testHash, wantZipHash: testHash},
+		{line: "example.com/m v1.0.0/go.mod " + testHash, wantGoModHash: testHash},
+		{line: "example.com/m v1.0.0 " + testHash + " min-age=0", wantZipHash: testHash},
+		{line: "example.com/m v1.0.0 " + testHash + " " + goModHash, wantZipHash: testHash, wantGoModHash: goModHash},
+		{line: "example.com/m v1.0.0 " + testHash + " " + goModHash + " min-age=0", wantZipHash: testHash, wantGoModHash: goModHash},
+		{line: "example.com/m v1.0.0 " + testHash + " " + goModHash + " " + testHash, wantErr: true},
+		{line: "example.com/m v1.0.0/go.mod " + testHash + " " + goModHash, wantErr: true},
+		{line: "example.com/m v1.0.0 " + testHash + " h1:bogus", wantErr: true},
+		{line: "example.com/m * " + testHash + " " + goModHash, wantErr: true},
+		{line: "!example.com/m v1.0.0 " + testHash + " " + goModHash, wantErr: true},
+		{line: "example.com/m v1.0.0"},
+		{line: "example.com/m v1.0.0 h1:bogus", wantErr: true},
+		{line: "example.com/m * " + testHash, wantErr: true},
+		{line: "example.com/m v1.* " + testHash, wantErr: true},
+		{line: "example.com/m >=v1.0.0 " + testHash, wantErr: true},
+		{line: "example.com/m v1.0.0 v1.0.1 " + testHash, wantErr: true},
+		{line: "example.com/* v1.0.0 " + testHash, wantErr: true},
+		{line: "!example.com/m v1.0.0 " + testHash, wantErr: true},
+	}
+	for _, test := range tests {
+		modules, err := ReadAllowedModules(strings.NewReader(test.line))
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ReadAllowedModules(%q) succeeded, want error", test.line)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ReadAllowedModules(%q) failed: %s", test.line, err)
+			continue
+		}
+		if len(modules) != 1 {
+			t.Errorf("ReadAllowedModules(%q) returned %d entries, want 1", test.line, len(modules))
+			continue
+		}
+		m := modules[0]
+		if m.Version != "v1.0.0" || m.ZipHash != test.wantZipHash || m.GoModHash != test.wantGoModHash {
+			t.Errorf("ReadAllowedModules(%q) = version %q, zip hash %q, go.mod hash %q; want v1.0.0, %q, %q", test.line, m.Version, m.ZipHash, m.GoModHash, test.wantZipHash, test.wantGoModHash)
+		}
+	}
+}
+
+func TestReadAllowedModulesDeny(t *testing.T) {
+	tests := []struct {
+		line            string
+		wantDeny        bool
+		wantPath        goproxy.ModulePath
+		wantPathPattern string
+		wantErr         bool
+	}{
+		{line: "example.com/m *", wantPath: "example.com/m"},
+		{line: "!example.com/m *", wantDeny: true, wantPath: "example.com/m"},
+		{line: "!example.com/m v1.1.50", wantDeny: true, wantPath: "example.com/m"},
+		{line: "!example.com/m <v1.2.0", wantDeny: true, wantPath: "example.com/m"},
+		{line: "!example.com/* *", wantDeny: true, wantPathPattern: "example.com/*"},
+		{line: "!example.com/m/... *", wantDeny: true, wantPathPattern: "example.com/m/..."},
+		{line: "! example.com/m *", wantErr: true},
+		{line: "!!example.com/m *", wantErr: true},
+		{line: "!example.com/m * min-age=7d", wantErr: true},
+	}
+	for _, test := range tests {
+		modules, err := ReadAllowedModules(strings.NewReader(test.line))
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ReadAllowedModules(%q) succeeded, want error", test.line)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ReadAllowedModules(%q) failed: %s", test.line, err)
+			continue
+		}
+		m := modules[0]
+		if m.Deny != test.wantDeny || m.Path != test.wantPath || m.PathPattern != test.wantPathPattern {
+			t.Errorf("ReadAllowedModules(%q) = deny %v, path %q, pattern %q; want %v, %q, %q", test.line, m.Deny, m.Path, m.PathPattern, test.wantDeny, test.wantPath, test.wantPathPattern)
+		}
+		if got := m.String(); got != test.line {
+			t.Errorf("ReadAllowedModules(%q).String() = %q", test.line, got)
+		}
+	}
+}
+
+func TestReadAllowedModulesPatternVersions(t *testing.T) {
+	tests := []struct {
+		line    string
+		wantErr bool
+	}{
+		{line: "golang.org/x/* *"},
+		{line: "golang.org/x/* >=v0.20.0"},
+		{line: "github.com/aws/* v1.*"},
+		{line: "github.com/aws/* ^v1.2.0 +prerelease"},
+		{line: "github.com/aws/... ~v1.4"},
+		{line: "golang.org/x/* v0.20.0"},
+		{line: "golang.org/x/* >=v0.20.0 min-age=1d"},
+		{line: "golang.org/x/* >=0.20.0", wantErr: true},
+		{line: "golang.org/x/[ *", wantErr: true},
+	}
+	for _, test := range tests {
+		modules, err := ReadAllowedModules(strings.NewReader(test.line))
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ReadAllowedModules(%q) succeeded, want error", test.line)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ReadAllowedModules(%q) failed: %s", test.line, err)
+		} else if modules[0].PathPattern == "" {
+			t.Errorf("ReadAllowedModules(%q) did not set PathPattern", test.line)
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		str     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{str: "0", want: 0},
+		{str: "7d", want: 7 * 24 * time.Hour},
+		{str: "0d", want: 0},
+		{str: "36h", want: 36 * time.Hour},
+		{str: "1h30m", want: 90 * time.Minute},
+		{str: "-1h", wantErr: true},
+		{str: "-1d", wantErr: true},
+		{str: "1.5d", wantErr: true},
+		{str: "d", wantErr: true},
+		{str: "99999d", wantErr: true},
+		{str: "7", wantErr: true},
+		{str: "", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := ParseAge(test.str)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ParseAge(%q) succeeded, want error", test.str)
+			}
+		} else if err != nil {
+			t.Errorf("ParseAge(%q) failed: %s", test.str, err)
+		} else if got != test.want {
+			t.Errorf("ParseAge(%q) = %s, want %s", test.str, got, test.want)
+		}
+	}
+}
+
+func TestReadAllowedModulesMinAge(t *testing.T) {
+	tests := []struct {
+		line       string
+		wantMinAge time.Duration
+		wantErr    bool
+	}{
+		{line: "example.com/m * min-age=7d", wantMinAge: 7 * 24 * time.Hour},
+		{line: "example.com/m v1.0.0 min-age=0", wantMinAge: 0},
+		{line: "example.com/* >=v1.0.0 <v2.0.0 min-age=12h", wantMinAge: 12 * time.Hour},
+		{line: "example.com/m * min-age=soon", wantErr: true},
+		{line: "example.com/m * max-age=7d", wantErr: true},
+		{line: "example.com/m min-age=7d", wantErr: true},
+	}
+	for _, test := range tests {
+		modules, err := ReadAllowedModules(strings.NewReader(test.line))
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ReadAllowedModules(%q) succeeded, want error", test.line)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ReadAllowedModules(%q) failed: %s", test.line, err)
+		} else if minAge := modules[0].MinAge; minAge == nil || *minAge != test.wantMinAge {
+			t.Errorf("ReadAllowedModules(%q) = min age %v, want %s", test.line, minAge, test.wantMinAge)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+// FormatAllowlistLine returns an allowlist line for the given module path and version, followed
+// by the zip and go.mod hashes that are non-empty.  If only the go.mod hash is non-empty, the
+// version is given a /go.mod suffix, as in go.sum.
+func FormatAllowlistLine(path goproxy.ModulePath, version string, zipHash string, goModHash string) string {
+	switch {
+	case zipHash != "" && goModHash != "":
+		return path.String() + "\t" + version + "\t" + zipHash + "\t" + goModHash
+	case zipHash != "":
+		return path.String() + "\t" + version + "\t" + zipHash
+	case goModHash != "":
+		return path.String() + "\t" + version + "/go.mod\t" + goModHash
+	default:
+		return path.String() + "\t" + version
+	}
+}
+
+// allowlistLinePath returns the module path or pattern in the first field of the given
+// allowlist line, or the empty string if the line is blank or a comment
+func allowlistLinePath(line string) string {
+	if strings.HasPrefix(line, "#") {
+		return ""
+	}
+	f := strings.Fields(line)
+	if len(f) == 0 {
+		return ""
+	}
+	return f[0]
+}
+
+// InsertAllowlistLines inserts the given lines into the contents of an allowlist file,
+// leaving existing lines, including comments, untouched.  Each new line is placed
+// after the last existing line for the same module path.  If there is no such line, it
+// is placed before the first line (and any comments immediately preceding it) for a module
+// path that sorts after it, or at the end of the file.
+func InsertAllowlistLines(content []byte, newLines []string) []byte {
+	lines := strings.SplitAfter(string(content), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		lines[len(lines)-1] += "\n"
+	}
+
+	for _, newLine := range newLines {
+		newPath := allowlistLinePath(newLine)
+		insertAt := len(lines)
+		sameModule := false
+		for i, line := range lines {
+			linePath := allowlistLinePath(line)
+			if linePath == "" || strings.HasPrefix(linePath, "!") || isPathPattern(linePath) {
+				continue
+			}
+			if linePath == newPath {
+				insertAt = i + 1
+				sameModule = true
+			} else if !sameModule && linePath > newPath && insertAt == len(lines) {
+				insertAt = i
+			}
+		}
+		if !sameModule {
+			// keep comments attached to the line that follows them
+			for insertAt > 0 && insertAt < len(lines) && strings.HasPrefix(lines[insertAt-1], "#") {
+				insertAt--
+			}
+		}
+		lines = append(lines[:insertAt], append([]string{newLine + "\n"}, lines[insertAt:]...)...)
+	}
+
+	return []byte(strings.Join(lines, ""))
+}
+
+// approvalCommentPrefix begins the comment which ApproveAllowlistVersion places before
+// an approved line
+const approvalCommentPrefix = "# Approved by "
+
+// FormatApprovalComment returns the comment recording that the given user approved a line
+func FormatApprovalComment(user string, when time.Time) string {
+	return approvalCommentPrefix + user + " on " + when.UTC().Format(time.RFC3339)
+}
+
+// replaceField replaces the nth whitespace-separated field of line with replacement,
+// leaving the surrounding whitespace untouched
+func replaceField(line string, n int, replacement string) string {
+	start := 0
+	for i := 0; ; i++ {
+		start += len(line[start:]) - len(strings.TrimLeft(line[start:], " \t\r\n"))
+		end := start + strings.IndexAny(line[start:]+" ", " \t\r\n")
+		if i == n {
+			return line[:start] + replacement + line[end:]
+		}
+		start = end
+	}
+}
+
+// ApproveAllowlistVersion changes every line of an allowlist file which allows exactly
+// oldVersion of the given module to allow newVersion instead, leaving the rest of the file,
+// including the formatting of the changed lines, untouched.  Hashes pinned by the changed
+// lines are replaced with zipHash and goModHash.  Each changed line is preceded by the given
+// comment, which replaces any approval comment already preceding it.  The second return
+// value is false if no line was changed.
+func ApproveAllowlistVersion(content []byte, path goproxy.ModulePath, oldVersion, newVersion goproxy.ModuleVersion, zipHash, goModHash string, comment string) ([]byte, bool) {
+	lines := strings.SplitAfter(string(content), "\n")
+	lastChanged := -1
+	for i := 0; i < len(lines); i++ {
+		f := strings.Fields(lines[i])
+		if len(f) < 2 || f[0] != path.String() {
+			continue
+		}
+		switch f[1] {
+		case oldVersion.String():
+			lines[i] = replaceField(lines[i], 1, newVersion.String())
+			if len(f) > 2 && strings.HasPrefix(f[2], "h1:") {
+				lines[i] = replaceField(lines[i], 2, zipHash)
+			}
+			if len(f) > 3 && strings.HasPrefix(f[3], "h1:") {
+				lines[i] = replaceField(lines[i], 3, goModHash)
+			}
+		case oldVersion.String() + "/go.mod":
+			lines[i] = replaceField(lines[i], 1, newVersion.String()+"/go.mod")
+			if len(f) > 2 && strings.HasPrefix(f[2], "h1:") {
+				lines[i] = replaceField(lines[i], 2, goModHash)
+			}
+		default:
+			continue
+		}
+
+		if i > 0 && i-1 == lastChanged {
+			// a single comment covers consecutive lines, such as a go.sum pair
+		} else if i > 0 && strings.HasPrefix(lines[i-1], approvalCommentPrefix) {
+			lines[i-1] = comment + "\n"
+		} else {
+			lines = append(lines[:i], append([]string{comment + "\n"}, lines[i:]...)...)
+			i++
+		}
+		lastChanged = i
+	}
+	return []byte(strings.Join(lines, "")), lastChanged != -1
+}
+
+// WriteAllowlistFile atomically replaces the contents of the given file by writing
+// to a temporary file in the same directory and renaming it over the original.
+// The original file's permissions are preserved.
+func WriteAllowlistFile(filename string, content []byte) error {
+	return replaceFile(filename, content)
+}
+
+// replaceFile atomically replaces the contents of the given file, or creates it
+// with mode 0644, preserving the original file's permissions
+func replaceFile(filename string, content []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(filename); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	if _, err := tempFile.Write(content); err != nil {
+		return err
+	}
+	if err := tempFile.Chmod(mode); err != nil {
+		return err
+	}
+	if err := tempFile.Sync(); err != nil {
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tempFile.Name(), filename)
+}
@@ -0,0 +1,199 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"testing"
+)
+
+func TestFormatAllowlistLine(t *testing.T) {
+	const goModHash = "h1:BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBA="
+	tests := []struct {
+		zipHash   string
+		goModHash string
+		want      string
+	}{
+		{"", "", "example.com/m\tv1.0.0"},
+		{testHash, "", "example.com/m\tv1.0.0\t" + testHash},
+		{"", goModHash, "example.com/m\tv1.0.0/go.mod\t" + goModHash},
+		{testHash, goModHash, "example.com/m\tv1.0.0\t" + testHash + "\t" + goModHash},
+	}
+	for _, test := range tests {
+		if got := FormatAllowlistLine("example.com/m", "v1.0.0", test.zipHash, test.goModHash); got != test.want {
+			t.Errorf("FormatAllowlistLine(%q, %q) = %q, want %q", test.zipHash, test.goModHash, got, test.want)
+		}
+	}
+}
+
+func TestInsertAllowlistLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		newLines []string
+		want     string
+	}{
+		{
+			name:     "empty",
+			content:  "",
+			newLines: []string{"example.com/b v1.0.0", "example.com/a v1.0.0"},
+			want:     "example.com/a v1.0.0\nexample.com/b v1.0.0\n",
+		},
+		{
+			name:     "no trailing newline",
+			content:  "example.com/a v1.0.0",
+			newLines: []string{"example.com/b v1.0.0"},
+			want:     "example.com/a v1.0.0\nexample.com/b v1.0.0\n",
+		},
+		{
+			name:     "after same module",
+			content:  "example.com/a v1.0.0\nexample.com/a v1.1.0\nexample.com/c v1.0.0\n",
+			newLines: []string{"example.com/a v1.2.0"},
+			want:     "example.com/a v1.0.0\nexample.com/a v1.1.0\nexample.com/a v1.2.0\nexample.com/c v1.0.0\n",
+		},
+		{
+			name:     "before later module and its comments",
+			content:  "# header\n\nexample.com/a v1.0.0\n\n# c is needed by x\nexample.com/c v1.0.0\n",
+			newLines: []string{"example.com/b v1.0.0"},
+			want:     "# header\n\nexample.com/a v1.0.0\n\nexample.com/b v1.0.0\n# c is needed by x\nexample.com/c v1.0.0\n",
+		},
+		{
+			name:     "at end",
+			content:  "example.com/a v1.0.0\n# trailing comment\n",
+			newLines: []string{"example.com/b v1.0.0"},
+			want:     "example.com/a v1.0.0\n# trailing comment\nexample.com/b v1.0.0\n",
+		},
+		{
+			name:     "patterns and denies ignored",
+			content:  "golang.org/x/* *\n!example.com/z *\nexample.com/c v1.0.0\n",
+			newLines: []string{"example.com/b v1.0.0"},
+			want:     "golang.org/x/* *\n!example.com/z *\nexample.com/b v1.0.0\nexample.com/c v1.0.0\n",
+		},
+		{
+			name:     "hash lines kept together",
+			content:  "example.com/a v1.0.0 h1:x\nexample.com/a v1.0.0/go.mod h1:y\n",
+			newLines: []string{"example.com/a v1.1.0 h1:z", "example.com/a v1.1.0/go.mod h1:w"},
+			want:     "example.com/a v1.0.0 h1:x\nexample.com/a v1.0.0/go.mod h1:y\nexample.com/a v1.1.0 h1:z\nexample.com/a v1.1.0/go.mod h1:w\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := string(InsertAllowlistLines([]byte(test.content), test.newLines)); got != test.want {
+				t.Errorf("InsertAllowlistLines returned:\n%s\nwant:\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReplaceField(t *testing.T) {
+	tests := []struct {
+		line        string
+		n           int
+		replacement string
+		want        string
+	}{
+		{"a b c\n", 0, "x", "x b c\n"},
+		{"a b c\n", 1, "x", "a x c\n"},
+		{"a b c\n", 2, "x", "a b x\n"},
+		{"a b c", 2, "x", "a b x"},
+		{"  a\t\tbb   c\r\n", 1, "xyz", "  a\t\txyz   c\r\n"},
+	}
+	for _, test := range tests {
+		if got := replaceField(test.line, test.n, test.replacement); got != test.want {
+			t.Errorf("replaceField(%q, %d, %q) = %q, want %q", test.line, test.n, test.replacement, got, test.want)
+		}
+	}
+}
+
+func TestApproveAllowlistVersion(t *testing.T) {
+	const (
+		comment   = "# Approved by alice on 2026-01-02T03:04:05Z"
+		zipHash   = "h1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+		goModHash = "h1:BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBA="
+	)
+	tests := []struct {
+		name        string
+		content     string
+		want        string
+		wantChanged bool
+	}{
+		{
+			name:        "simple",
+			content:     "# header\n\nexample.com/m v1.0.0\nexample.com/n v1.0.0\n",
+			want:        "# header\n\n" + comment + "\nexample.com/m v1.1.0\nexample.com/n v1.0.0\n",
+			wantChanged: true,
+		},
+		{
+			name:        "formatting preserved",
+			content:     "example.com/m\t\tv1.0.0  \n",
+			want:        comment + "\nexample.com/m\t\tv1.1.0  \n",
+			wantChanged: true,
+		},
+		{
+			name:        "hashes replaced",
+			content:     "example.com/m v1.0.0 " + testHash + "\nexample.com/m v1.0.0/go.mod " + testHash + "\n",
+			want:        comment + "\nexample.com/m v1.1.0 " + zipHash + "\nexample.com/m v1.1.0/go.mod " + goModHash + "\n",
+			wantChanged: true,
+		},
+		{
+			name:        "hashes on one line replaced",
+			content:     "example.com/m v1.0.0 " + testHash + " " + testHash + " min-age=0\n",
+			want:        comment + "\nexample.com/m v1.1.0 " + zipHash + " " + goModHash + " min-age=0\n",
+			wantChanged: true,
+		},
+		{
+			name:        "previous approval replaced",
+			content:     "# Approved by bob on 2025-01-01T00:00:00Z\nexample.com/m v1.0.0\n",
+			want:        comment + "\nexample.com/m v1.1.0\n",
+			wantChanged: true,
+		},
+		{
+			name:        "other comment kept",
+			content:     "# needed by example.com/app\nexample.com/m v1.0.0\n",
+			want:        "# needed by example.com/app\n" + comment + "\nexample.com/m v1.1.0\n",
+			wantChanged: true,
+		},
+		{
+			name:        "separate lines",
+			content:     "example.com/m v1.0.0\nexample.com/n v1.0.0\nexample.com/m v1.0.0\n",
+			want:        comment + "\nexample.com/m v1.1.0\nexample.com/n v1.0.0\n" + comment + "\nexample.com/m v1.1.0\n",
+			wantChanged: true,
+		},
+		{
+			name:        "not present",
+			content:     "example.com/m *\nexample.com/m v1.0.1\n!example.com/m v1.0.0\nexample.com/m/sub v1.0.0\n",
+			want:        "example.com/m *\nexample.com/m v1.0.1\n!example.com/m v1.0.0\nexample.com/m/sub v1.0.0\n",
+			wantChanged: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, changed := ApproveAllowlistVersion([]byte(test.content), "example.com/m", "v1.0.0", "v1.1.0", zipHash, goModHash, comment)
+			if string(got) != test.want || changed != test.wantChanged {
+				t.Errorf("ApproveAllowlistVersion returned %v:\n%s\nwant %v:\n%s", changed, got, test.wantChanged, test.want)
+			}
+		})
+	}
+}
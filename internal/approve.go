@@ -0,0 +1,287 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+// Approvers are the users who may approve new versions in the web interface
+type Approvers struct {
+	passwordHashes map[string][]byte // username => bcrypt hash of password
+
+	// Successfully-verified credentials are remembered here, keyed by the SHA-256 hash of
+	// the username and password, so that proxy requests can be attributed to approvers
+	// without running bcrypt (see verifiedUser).  Since only correct passwords are
+	// remembered, this holds at most one entry per approver.
+	verified sync.Map
+}
+
+// dummyPasswordHash is compared against the passwords of unknown users, so that
+// authenticating an unknown user takes as long as authenticating a known one
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, err := bcrypt.GenerateFromPassword([]byte("depproxy"), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
+func ReadApprovers(r io.Reader) (*Approvers, error) {
+	approvers := &Approvers{passwordHashes: make(map[string][]byte)}
+
+	scanner := bufio.NewScanner(r)
+	lineno := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		lineno++
+
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		} else if len(f) != 2 {
+			return nil, fmt.Errorf("syntax error on line %d: two fields expected, but %d provided", lineno, len(f))
+		}
+		hash := []byte(f[1])
+		if _, err := bcrypt.Cost(hash); err != nil {
+			return nil, fmt.Errorf("syntax error on line %d: password hash is not a bcrypt hash: %w", lineno, err)
+		}
+		if _, exists := approvers.passwordHashes[f[0]]; exists {
+			return nil, fmt.Errorf("error on line %d: user %q is listed more than once", lineno, f[0])
+		}
+		approvers.passwordHashes[f[0]] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return approvers, nil
+}
+
+func (approvers *Approvers) authenticate(req *http.Request) (string, bool) {
+	if approvers == nil {
+		return "", false
+	}
+	user, password, ok := req.BasicAuth()
+	if !ok {
+		return "", false
+	}
+	key := credentialsKey(user, password)
+	if _, verified := approvers.verified.Load(key); verified {
+		return user, true
+	}
+	hash, exists := approvers.passwordHashes[user]
+	if !exists {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		return "", false
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return "", false
+	}
+	approvers.verified.Store(key, struct{}{})
+	return user, true
+}
+
+// verifiedUser returns the username of the approver whose credentials req carries, if
+// authenticate has previously verified them.  Unlike authenticate, it never runs bcrypt,
+// so it is cheap enough to call on every proxy request.
+func (approvers *Approvers) verifiedUser(req *http.Request) (string, bool) {
+	if approvers == nil {
+		return "", false
+	}
+	user, password, ok := req.BasicAuth()
+	if !ok {
+		return "", false
+	}
+	if _, verified := approvers.verified.Load(credentialsKey(user, password)); !verified {
+		return "", false
+	}
+	return user, true
+}
+
+func credentialsKey(user, password string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(user + "\x00" + password))
+}
+
+// isSameOrigin reports whether req was made by a page served by this server, to
+// prevent other sites from submitting approvals using the browser's credentials.
+// Requests with neither a Sec-Fetch-Site nor an Origin header are rejected, since
+// their origin can't be determined.
+func isSameOrigin(req *http.Request) bool {
+	if site := req.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site == "same-origin" || site == "none"
+	}
+	if origin := req.Header.Get("Origin"); origin != "" {
+		originURL, err := url.Parse(origin)
+		return err == nil && originURL.Host == req.Host
+	}
+	return false
+}
+
+// getApprovedHashes returns the hashes to pin for newVersion, if the allowlist pins
+// hashes for oldVersion.  If checksum database verification is enabled, it also
+// verifies newVersion against the checksum database.
+func (s *Server) getApprovedHashes(req *http.Request, module goproxy.ModulePath, oldVersion, newVersion goproxy.ModuleVersion) (zipHash string, goModHash string, err error) {
+	oldZipHash, oldGoModHash := s.getPinnedHashes(module, oldVersion)
+	verify := s.SumDBVerifierDir != ""
+	if oldZipHash != "" || verify {
+		zipReader, err := s.downloadUpstreamZip(req.Context(), module, newVersion)
+		if err != nil {
+			return "", "", err
+		}
+		newZipHash, err := hashZip(zipReader)
+		if err != nil {
+			return "", "", err
+		}
+		if verify {
+			if err := s.checkSumDB(module, newVersion.String(), newZipHash); err != nil {
+				return "", "", err
+			}
+		}
+		if oldZipHash != "" {
+			zipHash = newZipHash
+		}
+	}
+	if oldGoModHash != "" || verify {
+		goMod, err := s.downloadUpstreamFile(req.Context(), module, goproxy.ModRequest{Version: newVersion})
+		if err != nil {
+			return "", "", err
+		}
+		newGoModHash, err := hashGoMod(goMod)
+		if err != nil {
+			return "", "", err
+		}
+		if verify {
+			if err := s.checkSumDB(module, newVersion.String()+"/go.mod", newGoModHash); err != nil {
+				return "", "", err
+			}
+		}
+		if oldGoModHash != "" {
+			goModHash = newGoModHash
+		}
+	}
+	return zipHash, goModHash, nil
+}
+
+func (s *Server) serveApprove(w http.ResponseWriter, req *http.Request) {
+	if s.Approvers == nil || s.AllowlistFile == "" {
+		http.Error(w, "Approvals are not enabled on this server", http.StatusNotFound)
+		return
+	}
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !isSameOrigin(req) {
+		http.Error(w, "Cross-origin approvals are not allowed", http.StatusForbidden)
+		return
+	}
+	user, ok := s.Approvers.authenticate(req)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="depproxy", charset="UTF-8"`)
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	module, err := goproxy.MakeModulePath(req.FormValue("module"))
+	if err != nil {
+		http.Error(w, "Invalid module path: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	oldVersion, err := goproxy.MakeModuleVersion(req.FormValue("old"))
+	if err != nil {
+		http.Error(w, "Invalid module version: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	newVersion, err := goproxy.MakeModuleVersion(req.FormValue("new"))
+	if err != nil {
+		http.Error(w, "Invalid module version: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !newVersion.IsCanonical() {
+		http.Error(w, fmt.Sprintf("Invalid module version: %q is not a canonical version", newVersion), http.StatusBadRequest)
+		return
+	}
+
+	zipHash, goModHash, err := s.getApprovedHashes(req, module, oldVersion, newVersion)
+	if errors.Is(err, errNotFound) {
+		http.Error(w, fmt.Sprintf("%s@%s not found at upstream proxy", module, newVersion), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("Error verifying %s@%s: %s", module, newVersion, err), http.StatusBadGateway)
+		return
+	}
+
+	if err := s.approveVersion(module, oldVersion, newVersion, zipHash, goModHash, FormatApprovalComment(user, time.Now())); err != nil {
+		http.Error(w, fmt.Sprintf("Error approving %s@%s: %s", module, newVersion, err), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, req, "/", http.StatusSeeOther)
+}
+
+// approveVersion rewrites the allowlist file to allow newVersion of the module instead of
+// oldVersion, and applies the new allowlist to the server
+func (s *Server) approveVersion(module goproxy.ModulePath, oldVersion, newVersion goproxy.ModuleVersion, zipHash, goModHash string, comment string) error {
+	s.approveMu.Lock()
+	defer s.approveMu.Unlock()
+
+	content, err := os.ReadFile(s.AllowlistFile)
+	if err != nil {
+		return err
+	}
+	newContent, changed := ApproveAllowlistVersion(content, module, oldVersion, newVersion, zipHash, goModHash, comment)
+	if !changed {
+		return fmt.Errorf("the allowlist file does not contain %s@%s", module, oldVersion)
+	}
+	modules, err := ReadAllowedModules(bytes.NewReader(newContent))
+	if err != nil {
+		return fmt.Errorf("the new allowlist would be invalid: %w", err)
+	}
+	if err := WriteAllowlistFile(s.AllowlistFile, newContent); err != nil {
+		return err
+	}
+	s.SetAllowedModules(modules)
+	return nil
+}
@@ -0,0 +1,314 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"cmp"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+func testPasswordHash(t *testing.T, password string) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(hash)
+}
+
+func TestReadApprovers(t *testing.T) {
+	hash := testPasswordHash(t, "secret")
+	tests := []struct {
+		file    string
+		users   []string
+		wantErr bool
+	}{
+		{file: "", users: nil},
+		{file: "# comment\n\nalice " + hash + "\nbob " + hash + "\n", users: []string{"alice", "bob"}},
+		{file: "alice " + hash + "\nalice " + hash + "\n", wantErr: true},
+		{file: "alice\n", wantErr: true},
+		{file: "alice " + hash + " extra\n", wantErr: true},
+		{file: "alice 2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b\n", wantErr: true},
+		{file: "alice $2a$10$tooshort\n", wantErr: true},
+	}
+	for _, test := range tests {
+		approvers, err := ReadApprovers(strings.NewReader(test.file))
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ReadApprovers(%q) succeeded, want error", test.file)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ReadApprovers(%q) failed: %s", test.file, err)
+			continue
+		}
+		if len(approvers.passwordHashes) != len(test.users) {
+			t.Errorf("ReadApprovers(%q) returned %d users, want %d", test.file, len(approvers.passwordHashes), len(test.users))
+		}
+		for _, user := range test.users {
+			if _, ok := approvers.passwordHashes[user]; !ok {
+				t.Errorf("ReadApprovers(%q) did not return user %q", test.file, user)
+			}
+		}
+	}
+}
+
+func TestApproversAuthenticate(t *testing.T) {
+	approvers, err := ReadApprovers(strings.NewReader("alice " + testPasswordHash(t, "secret") + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		user     string
+		password string
+		noAuth   bool
+		want     bool
+	}{
+		{user: "alice", password: "secret", want: true},
+		{user: "alice", password: "secret", want: true}, // verified from the cache
+		{user: "alice", password: "wrong", want: false},
+		{user: "alice", password: "", want: false},
+		{user: "bob", password: "secret", want: false},
+		{noAuth: true, want: false},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "/approve", nil)
+		if !test.noAuth {
+			req.SetBasicAuth(test.user, test.password)
+		}
+		user, ok := approvers.authenticate(req)
+		if ok != test.want || (ok && user != test.user) {
+			t.Errorf("authenticate(%q, %q) = %q, %v, want %v", test.user, test.password, user, ok, test.want)
+		}
+	}
+
+	var nilApprovers *Approvers
+	req := httptest.NewRequest("POST", "/approve", nil)
+	req.SetBasicAuth("alice", "secret")
+	if _, ok := nilApprovers.authenticate(req); ok {
+		t.Errorf("authenticate with nil Approvers succeeded")
+	}
+}
+
+func TestApproversVerifiedUser(t *testing.T) {
+	approvers, err := ReadApprovers(strings.NewReader("alice " + testPasswordHash(t, "secret") + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		user         string
+		password     string
+		authenticate bool // whether to call authenticate first
+		want         bool
+	}{
+		{user: "alice", password: "secret", want: false}, // not yet verified
+		{user: "alice", password: "wrong", authenticate: true, want: false},
+		{user: "bob", password: "secret", authenticate: true, want: false},
+		{user: "alice", password: "secret", authenticate: true, want: true},
+		{user: "alice", password: "secret", want: true},
+		{user: "alice", password: "secret2", want: false},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/proxy/example.com/m/@v/list", nil)
+		req.SetBasicAuth(test.user, test.password)
+		if test.authenticate {
+			approvers.authenticate(req)
+		}
+		user, ok := approvers.verifiedUser(req)
+		if ok != test.want || (ok && user != test.user) {
+			t.Errorf("verifiedUser(%q, %q) = %q, %v, want %v", test.user, test.password, user, ok, test.want)
+		}
+	}
+}
+
+func TestIsSameOrigin(t *testing.T) {
+	tests := []struct {
+		secFetchSite string
+		origin       string
+		want         bool
+	}{
+		{secFetchSite: "same-origin", want: true},
+		{secFetchSite: "none", want: true},
+		{secFetchSite: "same-site", want: false},
+		{secFetchSite: "cross-site", want: false},
+		{secFetchSite: "cross-site", origin: "https://depproxy.example.com", want: false},
+		{origin: "https://depproxy.example.com", want: true},
+		{origin: "https://evil.example.com", want: false},
+		{origin: "null", want: false},
+		{want: false},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "https://depproxy.example.com/approve", nil)
+		if test.secFetchSite != "" {
+			req.Header.Set("Sec-Fetch-Site", test.secFetchSite)
+		}
+		if test.origin != "" {
+			req.Header.Set("Origin", test.origin)
+		}
+		if got := isSameOrigin(req); got != test.want {
+			t.Errorf("isSameOrigin(Sec-Fetch-Site=%q, Origin=%q) = %v, want %v", test.secFetchSite, test.origin, got, test.want)
+		}
+	}
+}
+
+func TestServeApprove(t *testing.T) {
+	goMod := []byte("module example.com/pinned\n")
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/example.com/pinned/@v/v1.1.0.mod" {
+			w.Write(goMod)
+		} else {
+			http.NotFound(w, req)
+		}
+	}))
+	defer upstream.Close()
+	goModHash, err := hashGoMod(goMod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	approvers, err := ReadApprovers(strings.NewReader("alice " + testPasswordHash(t, "secret") + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		origin     string
+		noAuth     bool
+		form       url.Values
+		disabled   bool
+		wantStatus int
+		wantFile   string
+	}{
+		{
+			name:       "approved",
+			form:       url.Values{"module": {"example.com/m"}, "old": {"v1.0.0"}, "new": {"v1.1.0"}},
+			wantStatus: http.StatusSeeOther,
+			wantFile:   "# Approved by alice on \nexample.com/m v1.1.0\nexample.com/pinned v1.0.0/go.mod " + testHash + "\n",
+		},
+		{
+			name:       "hash pinned",
+			form:       url.Values{"module": {"example.com/pinned"}, "old": {"v1.0.0"}, "new": {"v1.1.0"}},
+			wantStatus: http.StatusSeeOther,
+			wantFile:   "example.com/m v1.0.0\n# Approved by alice on \nexample.com/pinned v1.1.0/go.mod " + goModHash + "\n",
+		},
+		{
+			name:       "new version not found",
+			form:       url.Values{"module": {"example.com/pinned"}, "old": {"v1.0.0"}, "new": {"v1.2.0"}},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "old version not in allowlist",
+			form:       url.Values{"module": {"example.com/m"}, "old": {"v0.9.0"}, "new": {"v1.1.0"}},
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:       "query",
+			form:       url.Values{"module": {"example.com/m"}, "old": {"v1.0.0"}, "new": {"latest"}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "non-canonical version",
+			form:       url.Values{"module": {"example.com/m"}, "old": {"v1.0.0"}, "new": {"v1.1"}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "get",
+			method:     http.MethodGet,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "cross origin",
+			origin:     "https://evil.example.com",
+			form:       url.Values{"module": {"example.com/m"}, "old": {"v1.0.0"}, "new": {"v1.1.0"}},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "unauthenticated",
+			noAuth:     true,
+			form:       url.Values{"module": {"example.com/m"}, "old": {"v1.0.0"}, "new": {"v1.1.0"}},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "disabled",
+			disabled:   true,
+			form:       url.Values{"module": {"example.com/m"}, "old": {"v1.0.0"}, "new": {"v1.1.0"}},
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			const allowlist = "example.com/m v1.0.0\nexample.com/pinned v1.0.0/go.mod " + testHash + "\n"
+			s := newTestServer(t, upstream.URL, allowlist)
+			s.AllowlistFile = filepath.Join(t.TempDir(), "allowlist")
+			if err := os.WriteFile(s.AllowlistFile, []byte(allowlist), 0666); err != nil {
+				t.Fatal(err)
+			}
+			if !test.disabled {
+				s.Approvers = approvers
+			}
+
+			method := cmp.Or(test.method, http.MethodPost)
+			req := httptest.NewRequest(method, "https://depproxy.example.com/approve", strings.NewReader(test.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("Origin", cmp.Or(test.origin, "https://depproxy.example.com"))
+			if !test.noAuth {
+				req.SetBasicAuth("alice", "secret")
+			}
+			rec := httptest.NewRecorder()
+			s.HTTPHandler().ServeHTTP(rec, req)
+			if rec.Code != test.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, test.wantStatus, strings.TrimSpace(rec.Body.String()))
+			}
+
+			content, err := os.ReadFile(s.AllowlistFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the approval time varies, so remove it before comparing
+			got := regexp.MustCompile(`(?m)^(# Approved by alice on ).*$`).ReplaceAllString(string(content), "$1")
+			wantFile := cmp.Or(test.wantFile, allowlist)
+			if got != wantFile {
+				t.Errorf("allowlist file is:\n%s\nwant:\n%s", got, wantFile)
+			}
+			if module, version := test.form.Get("module"), test.form.Get("new"); test.wantFile != "" && !s.isModuleAllowed(goproxy.ModulePath(module), goproxy.ModuleVersion(version)) {
+				t.Errorf("%s@%s is not allowed after approval", module, version)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+// Maximum number of bytes of an error response to include in an audit record
+const maxAuditErrorSize = 512
+
+type auditRecord struct {
+	Time           time.Time
+	Client         string // IP address of the client
+	User           string `json:",omitempty"` // authenticated identity of the client, if any
+	Module         goproxy.ModulePath
+	Version        goproxy.ModuleVersion `json:",omitempty"` // empty for LatestRequest and ListRequest
+	Request        string                // LatestRequest, ListRequest, InfoRequest, ModRequest, or ZipRequest
+	Decision       string                // allow, deny, not-found, or error
+	Status         int                   // HTTP status code of the response
+	Error          string                `json:",omitempty"` // error message sent to the client, if any
+	Policy         string                `json:",omitempty"` // policy which denied the request, if any (see recordPolicy)
+	AllowlistLine  int                   `json:",omitempty"` // line number of the allowlist entry which decided the request, if any
+	AllowlistEntry string                `json:",omitempty"` // allowlist entry which decided the request, if any
+}
+
+// Policies which can deny a request
+const (
+	policyAllowlist  = "allowlist"
+	policyRetraction = "retraction"
+	policyLicense    = "license"
+	policyMinAge     = "min-age"
+)
+
+// auditResponseWriter records the status code and error message of a response, and the policy
+// which denied the request
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status int
+	error  []byte
+	policy string
+}
+
+// recordPolicy records the policy which denied a request, if w is an auditResponseWriter
+func recordPolicy(w http.ResponseWriter, policy string) {
+	if w, ok := w.(*auditResponseWriter); ok {
+		w.policy = policy
+	}
+}
+
+func (w *auditResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditResponseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.status >= 400 && len(w.error) < maxAuditErrorSize {
+		w.error = append(w.error, data[:min(len(data), maxAuditErrorSize-len(w.error))]...)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func requestType(request goproxy.Request) string {
+	switch request.(type) {
+	case goproxy.LatestRequest:
+		return "LatestRequest"
+	case goproxy.ListRequest:
+		return "ListRequest"
+	case goproxy.InfoRequest:
+		return "InfoRequest"
+	case goproxy.ModRequest:
+		return "ModRequest"
+	case goproxy.ZipRequest:
+		return "ZipRequest"
+	default:
+		return ""
+	}
+}
+
+func requestVersion(request goproxy.Request) goproxy.ModuleVersion {
+	switch request := request.(type) {
+	case goproxy.InfoRequest:
+		return request.Version
+	case goproxy.ModRequest:
+		return request.Version
+	case goproxy.ZipRequest:
+		return request.Version
+	default:
+		return ""
+	}
+}
+
+// authenticatedIdentity returns the verified identity of the client which made req: the
+// common name of its TLS client certificate, or the username of an approver who supplied
+// a password that was previously verified by the web interface.  Passwords are never
+// checked here, since bcrypt is too slow to run on every proxy request.  If the client is
+// not authenticated, the empty string is returned.
+func (s *Server) authenticatedIdentity(req *http.Request) string {
+	if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 && len(req.TLS.VerifiedChains[0]) > 0 {
+		return req.TLS.VerifiedChains[0][0].Subject.CommonName
+	}
+	if user, ok := s.Approvers.verifiedUser(req); ok {
+		return user
+	}
+	return ""
+}
+
+func auditDecision(status int) string {
+	switch {
+	case status < 400:
+		return "allow"
+	case status == http.StatusForbidden:
+		return "deny"
+	case status == http.StatusNotFound || status == http.StatusGone:
+		return "not-found"
+	default:
+		return "error"
+	}
+}
+
+// finishProxyRequest records the outcome of a proxy request in the metrics and audit log
+func (s *Server) finishProxyRequest(httpReq *http.Request, w *auditResponseWriter, module goproxy.ModulePath, request goproxy.Request) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	s.getMetrics().proxyRequests.inc(requestType(request), auditDecision(w.status))
+	if s.AuditLog != nil {
+		s.writeAuditRecord(httpReq, w, module, request)
+	}
+}
+
+// writeAuditRecord writes an audit record for a proxy request to s.AuditLog
+func (s *Server) writeAuditRecord(httpReq *http.Request, w *auditResponseWriter, module goproxy.ModulePath, request goproxy.Request) {
+	record := auditRecord{
+		Time:     time.Now().UTC(),
+		Client:   httpReq.RemoteAddr,
+		User:     s.authenticatedIdentity(httpReq),
+		Module:   module,
+		Version:  requestVersion(request),
+		Request:  requestType(request),
+		Decision: auditDecision(w.status),
+		Status:   w.status,
+		Error:    strings.TrimSpace(string(w.error)),
+		Policy:   w.policy,
+	}
+	if host, _, err := net.SplitHostPort(record.Client); err == nil {
+		record.Client = host
+	}
+	// If a policy other than the allowlist denied the request, the allowlist entry which
+	// allowed the version didn't decide the request
+	if w.policy == "" || w.policy == policyAllowlist {
+		if entry := s.getAllowlist().rules(module).decidingEntry(record.Version); entry != nil {
+			record.AllowlistLine = entry.Line
+			record.AllowlistEntry = entry.String()
+		}
+	}
+
+	var line bytes.Buffer
+	encoder := json.NewEncoder(&line)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(record); err != nil {
+		panic(err)
+	}
+
+	s.auditMu.Lock()
+	defer s.auditMu.Unlock()
+	if _, err := s.AuditLog.Write(line.Bytes()); err != nil {
+		log.Printf("error writing audit record: %s", err)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditRecordPolicy(t *testing.T) {
+	publishTimes := map[string]time.Time{
+		"v0.8.0": time.Now().Add(-30 * 24 * time.Hour),
+		"v0.9.0": time.Now().Add(-30 * 24 * time.Hour),
+		"v1.0.0": time.Now().Add(-time.Hour),
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		version, isInfo := strings.CutSuffix(req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:], ".info")
+		if published, ok := publishTimes[version]; ok && isInfo {
+			fmt.Fprintf(w, `{"Version":%q,"Time":%q}`, version, published.Format(time.RFC3339))
+		} else {
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+	defer upstream.Close()
+
+	s := newTestServer(t, upstream.URL, "example.com/m * min-age=7d\n!example.com/m v0.8.0\n")
+	var auditLog bytes.Buffer
+	s.AuditLog = &auditLog
+
+	tests := []struct {
+		path     string
+		decision string
+		policy   string
+		line     int
+	}{
+		{"example.com/m/@v/v0.9.0.zip", "allow", "", 1},
+		{"example.com/m/@v/v1.0.0.zip", "deny", policyMinAge, 0},
+		{"example.com/m/@v/v0.8.0.zip", "deny", policyAllowlist, 2},
+		{"example.com/other/@v/v1.0.0.zip", "deny", policyAllowlist, 0},
+	}
+	for _, test := range tests {
+		auditLog.Reset()
+		s.serveProxyRequest(httptest.NewRecorder(), httptest.NewRequest("GET", "/proxy/"+test.path, nil))
+		var record auditRecord
+		if err := json.Unmarshal(auditLog.Bytes(), &record); err != nil {
+			t.Fatalf("%s: error parsing audit record %q: %s", test.path, auditLog.String(), err)
+		}
+		if record.Decision != test.decision || record.Policy != test.policy || record.AllowlistLine != test.line {
+			t.Errorf("%s: audit record has decision %q, policy %q, allowlist line %d; want %q, %q, %d", test.path, record.Decision, record.Policy, record.AllowlistLine, test.decision, test.policy, test.line)
+		}
+	}
+}
+
+func TestAuditDecision(t *testing.T) {
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{http.StatusOK, "allow"},
+		{http.StatusSeeOther, "allow"},
+		{http.StatusForbidden, "deny"},
+		{http.StatusNotFound, "not-found"},
+		{http.StatusGone, "not-found"},
+		{http.StatusBadRequest, "error"},
+		{http.StatusBadGateway, "error"},
+	}
+	for _, test := range tests {
+		if got := auditDecision(test.status); got != test.want {
+			t.Errorf("auditDecision(%d) = %q, want %q", test.status, got, test.want)
+		}
+	}
+}
+
+func TestAuditRecord(t *testing.T) {
+	upstream := newTestUpstream(t, "v1.0.0")
+	s := newTestServer(t, upstream.URL, "example.com/m v1.0.0\n")
+	approvers, err := ReadApprovers(strings.NewReader("alice " + testPasswordHash(t, "secret") + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Approvers = approvers
+	var auditLog bytes.Buffer
+	s.AuditLog = &auditLog
+
+	tests := []struct {
+		path     string
+		user     string
+		password string
+		verified bool // whether the web interface has verified the credentials
+		want     auditRecord
+	}{
+		{
+			path: "example.com/m/@v/v1.0.0.info",
+			want: auditRecord{Client: "192.0.2.1", Module: "example.com/m", Version: "v1.0.0", Request: "InfoRequest", Decision: "allow", Status: http.StatusSeeOther, AllowlistLine: 1, AllowlistEntry: "example.com/m v1.0.0"},
+		},
+		{
+			path: "example.com/m/@v/list",
+			user: "alice", password: "secret",
+			want: auditRecord{Client: "192.0.2.1", Module: "example.com/m", Request: "ListRequest", Decision: "allow", Status: http.StatusOK},
+		},
+		{
+			path: "example.com/m/@v/list",
+			user: "alice", password: "secret", verified: true,
+			want: auditRecord{Client: "192.0.2.1", User: "alice", Module: "example.com/m", Request: "ListRequest", Decision: "allow", Status: http.StatusOK},
+		},
+		{
+			path: "example.com/m/@v/v1.1.0.zip",
+			user: "alice", password: "wrong",
+			want: auditRecord{Client: "192.0.2.1", Module: "example.com/m", Version: "v1.1.0", Request: "ZipRequest", Decision: "deny", Status: http.StatusForbidden, Error: `Version "v1.1.0" of module "example.com/m" is not allowed`, Policy: policyAllowlist},
+		},
+		{
+			path: "example.com/m/@latest",
+			want: auditRecord{Client: "192.0.2.1", Module: "example.com/m", Request: "LatestRequest", Decision: "allow", Status: http.StatusSeeOther},
+		},
+	}
+	for _, test := range tests {
+		auditLog.Reset()
+		req := httptest.NewRequest("GET", "/proxy/"+test.path, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		if test.user != "" {
+			req.SetBasicAuth(test.user, test.password)
+		}
+		if test.verified {
+			if _, ok := approvers.authenticate(req); !ok {
+				t.Fatalf("%s: authenticate failed", test.path)
+			}
+		}
+		s.HTTPHandler().ServeHTTP(httptest.NewRecorder(), req)
+		if strings.Count(auditLog.String(), "\n") != 1 {
+			t.Errorf("%s: audit log is %q, want one line", test.path, auditLog.String())
+			continue
+		}
+		var record auditRecord
+		if err := json.Unmarshal(auditLog.Bytes(), &record); err != nil {
+			t.Fatalf("%s: error parsing audit record %q: %s", test.path, auditLog.String(), err)
+		}
+		if time.Since(record.Time) > time.Minute {
+			t.Errorf("%s: audit record has time %s", test.path, record.Time)
+		}
+		record.Time = time.Time{}
+		if record != test.want {
+			t.Errorf("%s: audit record is\n%+v\nwant\n%+v", test.path, record, test.want)
+		}
+	}
+}
+
+func TestAuditResponseWriterTruncatesError(t *testing.T) {
+	w := &auditResponseWriter{ResponseWriter: httptest.NewRecorder()}
+	w.WriteHeader(http.StatusBadGateway)
+	w.Write(bytes.Repeat([]byte("x"), maxAuditErrorSize-10))
+	w.Write(bytes.Repeat([]byte("y"), 20))
+	if len(w.error) != maxAuditErrorSize || !bytes.HasSuffix(w.error, bytes.Repeat([]byte("y"), 10)) {
+		t.Errorf("recorded error has length %d, want %d", len(w.error), maxAuditErrorSize)
+	}
+	w.WriteHeader(http.StatusOK)
+	if w.status != http.StatusBadGateway {
+		t.Errorf("status = %d after second WriteHeader, want %d", w.status, http.StatusBadGateway)
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+// A contentStore stores the files of module versions on disk.  File contents are stored
+// once under blobs/, named by their SHA-256 hash, and index/ maps each module file to the hash
+// of its contents.  Files in both directories are never modified once written.
+type contentStore struct {
+	dir string
+}
+
+func contentHash(content []byte) string {
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:])
+}
+
+func (store contentStore) indexPath(module goproxy.ModulePath, req goproxy.Request) string {
+	return filepath.Join(store.dir, "index", filepath.FromSlash(module.Escaped()), filepath.FromSlash(req.Path()))
+}
+
+func (store contentStore) blobPath(hash string) string {
+	return filepath.Join(store.dir, "blobs", "sha256", hash[:2], hash)
+}
+
+// createFile atomically creates a read-only file with the given content, unless the file
+// already exists, in which case fs.ErrExist is returned
+func createFile(filename string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	tempFile, err := os.CreateTemp(filepath.Dir(filename), ".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	if _, err := tempFile.Write(content); err != nil {
+		return err
+	}
+	if err := tempFile.Chmod(0444); err != nil {
+		return err
+	}
+	if err := tempFile.Sync(); err != nil {
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+	// Unlike rename, link fails if the file already exists
+	return os.Link(tempFile.Name(), filename)
+}
+
+// lookup returns the hash of the stored file for req, or an error satisfying
+// errors.Is(err, fs.ErrNotExist) if the file has not been stored
+func (store contentStore) lookup(module goproxy.ModulePath, req goproxy.Request) (string, error) {
+	index, err := os.ReadFile(store.indexPath(module, req))
+	if err != nil {
+		return "", err
+	}
+	hash := strings.TrimSpace(string(index))
+	if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("index file %s is malformed", store.indexPath(module, req))
+	}
+	return hash, nil
+}
+
+// read returns the stored content with the given hash, verifying that it is intact
+func (store contentStore) read(hash string) ([]byte, error) {
+	content, err := os.ReadFile(store.blobPath(hash))
+	if err != nil {
+		return nil, err
+	}
+	if contentHash(content) != hash {
+		return nil, fmt.Errorf("%s is corrupt", store.blobPath(hash))
+	}
+	return content, nil
+}
+
+// write stores content, whose hash must be hash
+func (store contentStore) write(hash string, content []byte) error {
+	blobPath := store.blobPath(hash)
+	if _, err := os.Stat(blobPath); err == nil {
+		if _, err := store.read(hash); err == nil {
+			return nil
+		}
+		// the existing blob is corrupt, so replace it with the correct content
+		if err := os.Remove(blobPath); err != nil {
+			return err
+		}
+	}
+	if err := createFile(blobPath, content); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	return nil
+}
+
+// writeIndex records hash as the hash of the file for req, unless a hash has already
+// been recorded, in which case the already-recorded hash is returned
+func (store contentStore) writeIndex(module goproxy.ModulePath, req goproxy.Request, hash string) (string, error) {
+	err := createFile(store.indexPath(module, req), []byte(hash+"\n"))
+	if errors.Is(err, fs.ErrExist) {
+		return store.lookup(module, req)
+	} else if err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// isCacheable reports whether the file for req can be stored in the cache: it must be
+// the .info, .mod, or .zip file of an allowed version, since these never change.  Queries
+// such as branch names, which .info requests may contain, are not versions and aren't cached.
+func (s *Server) isCacheable(module goproxy.ModulePath, req goproxy.Request) bool {
+	version := requestVersion(req)
+	return s.CacheDir != "" && version.IsSet() && version.IsCanonical() && s.isModuleAllowed(module, version)
+}
+
+// cacheMismatch reports that the upstream proxy served different content for a module file
+// than the content stored in the cache
+func (s *Server) cacheMismatch(module goproxy.ModulePath, req goproxy.Request, storedHash, upstreamHash string) error {
+	s.getMetrics().cacheRequests.inc("mismatch")
+	log.Printf("ALERT: upstream proxy served %s/%s with SHA-256 hash %s, but the cache contains a copy with hash %s; refusing to replace the cached copy", module, req.Path(), upstreamHash, storedHash)
+	return fmt.Errorf("upstream proxy served %s/%s with different content than was previously served", module, req.Path())
+}
+
+// A verifyFunc returns an error if the content of a file is not trustworthy
+type verifyFunc func(content []byte) error
+
+// A verificationError is returned by fetchFile when a file fails verification
+type verificationError struct {
+	err error
+}
+
+func (err *verificationError) Error() string { return err.err.Error() }
+func (err *verificationError) Unwrap() error { return err.err }
+
+// fetchVerifiedFile is like fetchFile, but verifies the file if it needs verification
+// (see needsVerification)
+func (s *Server) fetchVerifiedFile(ctx context.Context, module goproxy.ModulePath, req goproxy.Request) ([]byte, error) {
+	var verify verifyFunc
+	if s.needsVerification(module, req) {
+		verify = func(content []byte) error { return s.verifyFile(module, req, content) }
+	}
+	return s.fetchFile(ctx, module, req, verify)
+}
+
+// fetchFile returns the contents of the file for req.  If the file is cacheable, it is
+// served from the cache if possible, or else downloaded from the upstream proxy and stored
+// in the cache.  Otherwise, it is downloaded from the upstream proxy.  If verify is non-nil,
+// the content is passed to it, and a *verificationError is returned if it returns an error.  Downloaded
+// content is verified before it is stored, since stored content can never be replaced.
+func (s *Server) fetchFile(ctx context.Context, module goproxy.ModulePath, req goproxy.Request, verify verifyFunc) ([]byte, error) {
+	if verify == nil {
+		verify = func([]byte) error { return nil }
+	} else {
+		verifyContent := verify
+		verify = func(content []byte) error {
+			if err := verifyContent(content); err != nil {
+				return &verificationError{err: err}
+			}
+			return nil
+		}
+	}
+	if !s.isCacheable(module, req) {
+		content, err := s.downloadUpstreamFile(ctx, module, req)
+		if err != nil {
+			return nil, err
+		}
+		if err := verify(content); err != nil {
+			return nil, err
+		}
+		return content, nil
+	}
+	store := contentStore{dir: s.CacheDir}
+
+	storedHash, err := store.lookup(module, req)
+	if err == nil {
+		content, err := store.read(storedHash)
+		if err == nil {
+			s.getMetrics().cacheRequests.inc("hit")
+			if err := verify(content); err != nil {
+				return nil, err
+			}
+			return content, nil
+		}
+		log.Printf("cached copy of %s/%s is unusable (%s); downloading it again", module, req.Path(), err)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	s.getMetrics().cacheRequests.inc("miss")
+
+	content, err := s.downloadUpstreamFile(ctx, module, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := verify(content); err != nil {
+		return nil, err
+	}
+	upstreamHash := contentHash(content)
+	if storedHash != "" && storedHash != upstreamHash {
+		return nil, s.cacheMismatch(module, req, storedHash, upstreamHash)
+	}
+	if err := store.write(upstreamHash, content); err != nil {
+		return nil, fmt.Errorf("error storing %s/%s in cache: %w", module, req.Path(), err)
+	}
+	if storedHash == "" {
+		storedHash, err = store.writeIndex(module, req, upstreamHash)
+		if err != nil {
+			return nil, fmt.Errorf("error storing %s/%s in cache: %w", module, req.Path(), err)
+		} else if storedHash != upstreamHash {
+			return nil, s.cacheMismatch(module, req, storedHash, upstreamHash)
+		}
+	}
+	return content, nil
+}
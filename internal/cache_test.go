@@ -0,0 +1,271 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+// newTestServer returns a Server whose only upstream is the given URL and whose allowlist
+// is read from allowlist
+func newTestServer(t *testing.T, upstreamURL string, allowlist string) *Server {
+	t.Helper()
+	upstream, err := ParseUpstream(upstreamURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modules, err := ReadAllowedModules(strings.NewReader(allowlist))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Upstreams: []*Upstream{upstream}}
+	s.SetAllowedModules(modules)
+	return s
+}
+
+func TestIsCacheable(t *testing.T) {
+	s := newTestServer(t, "https://proxy.golang.org", "example.com/allowed *\n")
+	s.CacheDir = t.TempDir()
+	tests := []struct {
+		module goproxy.ModulePath
+		req    goproxy.Request
+		want   bool
+	}{
+		{"example.com/allowed", goproxy.ZipRequest{Version: "v1.2.3"}, true},
+		{"example.com/allowed", goproxy.ModRequest{Version: "v1.2.3"}, true},
+		{"example.com/allowed", goproxy.InfoRequest{Version: "v1.2.3"}, true},
+		{"example.com/allowed", goproxy.ZipRequest{Version: "v2.0.0+incompatible"}, true},
+		{"example.com/allowed", goproxy.InfoRequest{Version: "v0.0.0-20240102030405-abcdefabcdef"}, true},
+		{"example.com/allowed", goproxy.InfoRequest{Version: "main"}, false},
+		{"example.com/allowed", goproxy.InfoRequest{Version: "v1.2"}, false},
+		{"example.com/allowed", goproxy.ListRequest{}, false},
+		{"example.com/allowed", goproxy.LatestRequest{}, false},
+		{"example.com/other", goproxy.ZipRequest{Version: "v1.2.3"}, false},
+	}
+	for _, test := range tests {
+		if got := s.isCacheable(test.module, test.req); got != test.want {
+			t.Errorf("isCacheable(%s, %s) = %v, want %v", test.module, test.req.Path(), got, test.want)
+		}
+	}
+}
+
+func TestFetchFileCachesIncompatibleVersion(t *testing.T) {
+	var requests atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		w.Write([]byte("module example.com/m\n"))
+	}))
+	defer upstream.Close()
+
+	s := newTestServer(t, upstream.URL, "example.com/m *\n")
+	s.CacheDir = t.TempDir()
+	req := goproxy.ModRequest{Version: "v2.0.0+incompatible"}
+	for i := 0; i < 2; i++ {
+		content, err := s.fetchFile(context.Background(), "example.com/m", req, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != "module example.com/m\n" {
+			t.Errorf("fetchFile returned %q", content)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("upstream received %d requests, want 1", n)
+	}
+}
+
+func TestFetchFileDoesNotCacheUnverifiedContent(t *testing.T) {
+	var tampered atomic.Bool
+	tampered.Store(true)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if tampered.Load() {
+			w.Write([]byte("module example.com/evil\n"))
+		} else {
+			w.Write([]byte("module example.com/m\n"))
+		}
+	}))
+	defer upstream.Close()
+
+	s := newTestServer(t, upstream.URL, "example.com/m *\n")
+	s.CacheDir = t.TempDir()
+	req := goproxy.ModRequest{Version: "v1.0.0"}
+	verify := func(content []byte) error {
+		if string(content) != "module example.com/m\n" {
+			return errors.New("checksum mismatch")
+		}
+		return nil
+	}
+
+	_, err := s.fetchFile(context.Background(), "example.com/m", req, verify)
+	var verifyErr *verificationError
+	if !errors.As(err, &verifyErr) {
+		t.Fatalf("fetchFile returned %v, want verification error", err)
+	}
+
+	tampered.Store(false)
+	content, err := s.fetchFile(context.Background(), "example.com/m", req, verify)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "module example.com/m\n" {
+		t.Errorf("fetchFile returned %q", content)
+	}
+}
+
+func TestContentStore(t *testing.T) {
+	store := contentStore{dir: t.TempDir()}
+	req := goproxy.ModRequest{Version: "v1.0.0"}
+	content := []byte("module example.com/m\n")
+	hash := contentHash(content)
+
+	if _, err := store.lookup("example.com/m", req); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("lookup of unstored file returned %v, want fs.ErrNotExist", err)
+	}
+	if err := store.write(hash, content); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.write(hash, content); err != nil {
+		t.Fatalf("writing existing blob failed: %s", err)
+	}
+	if got, err := store.writeIndex("example.com/m", req, hash); err != nil || got != hash {
+		t.Fatalf("writeIndex = %q, %v; want %q", got, err, hash)
+	}
+	otherHash := contentHash([]byte("other"))
+	if got, err := store.writeIndex("example.com/m", req, otherHash); err != nil || got != hash {
+		t.Fatalf("second writeIndex = %q, %v; want existing hash %q", got, err, hash)
+	}
+	if got, err := store.lookup("example.com/m", req); err != nil || got != hash {
+		t.Fatalf("lookup = %q, %v; want %q", got, err, hash)
+	}
+	if got, err := store.read(hash); err != nil || string(got) != string(content) {
+		t.Fatalf("read = %q, %v; want %q", got, err, content)
+	}
+
+	// a corrupt blob is detected when read and replaced when written
+	corruptFile(t, store.blobPath(hash))
+	if _, err := store.read(hash); err == nil {
+		t.Fatalf("read of corrupt blob succeeded")
+	}
+	if err := store.write(hash, content); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.read(hash); err != nil || string(got) != string(content) {
+		t.Fatalf("read after rewriting corrupt blob = %q, %v; want %q", got, err, content)
+	}
+
+	corruptFile(t, store.indexPath("example.com/m", req))
+	if _, err := store.lookup("example.com/m", req); err == nil || errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("lookup with malformed index returned %v, want malformed error", err)
+	}
+}
+
+// corruptFile overwrites a read-only file in the cache
+func corruptFile(t *testing.T, filename string) {
+	t.Helper()
+	if err := os.Chmod(filename, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFetchFileCorruptCache(t *testing.T) {
+	var upstreamContent atomic.Value
+	upstreamContent.Store("module example.com/m\n")
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(upstreamContent.Load().(string)))
+	}))
+	defer upstream.Close()
+
+	s := newTestServer(t, upstream.URL, "example.com/m *\n")
+	s.CacheDir = t.TempDir()
+	store := contentStore{dir: s.CacheDir}
+	req := goproxy.ModRequest{Version: "v1.0.0"}
+	ctx := context.Background()
+	if _, err := s.fetchFile(ctx, "example.com/m", req, nil); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := store.lookup("example.com/m", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a corrupt blob is downloaded again if the upstream serves the same content
+	corruptFile(t, store.blobPath(hash))
+	if content, err := s.fetchFile(ctx, "example.com/m", req, nil); err != nil || string(content) != "module example.com/m\n" {
+		t.Fatalf("fetchFile with corrupt blob = %q, %v", content, err)
+	}
+
+	// but is never replaced with different content
+	corruptFile(t, store.blobPath(hash))
+	upstreamContent.Store("module example.com/evil\n")
+	if content, err := s.fetchFile(ctx, "example.com/m", req, nil); err == nil {
+		t.Fatalf("fetchFile with corrupt blob and different upstream content returned %q", content)
+	}
+	if got, err := store.lookup("example.com/m", req); err != nil || got != hash {
+		t.Errorf("index changed to %q, %v; want %q", got, err, hash)
+	}
+}
+
+func TestServeCachedFile(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("module example.com/m\n"))
+	}))
+	s := newTestServer(t, upstream.URL, "example.com/m v1.0.0\n")
+	s.CacheDir = t.TempDir()
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{"/proxy/example.com/m/@v/v1.0.0.mod", http.StatusOK},
+		{"/proxy/example.com/m/@v/v1.1.0.mod", http.StatusOK}, // not cached, since not allowed
+	}
+	for _, test := range tests {
+		if rec := serveTestRequest(s, test.path); rec.Code != test.wantStatus || rec.Body.String() != "module example.com/m\n" {
+			t.Errorf("GET %s returned %d %q", test.path, rec.Code, rec.Body.String())
+		}
+	}
+
+	upstream.Close()
+	if rec := serveTestRequest(s, "/proxy/example.com/m/@v/v1.0.0.mod"); rec.Code != http.StatusOK || rec.Body.String() != "module example.com/m\n" {
+		t.Errorf("cached file returned %d %q after upstream went away", rec.Code, rec.Body.String())
+	}
+	if rec := serveTestRequest(s, "/proxy/example.com/m/@v/v1.1.0.mod"); rec.Code != http.StatusBadGateway {
+		t.Errorf("uncached file returned %d after upstream went away, want %d", rec.Code, http.StatusBadGateway)
+	}
+}
@@ -33,6 +33,7 @@ import (
 	"io"
 	"net/http"
 	"runtime/debug"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 	"src.agwa.name/depproxy/internal/goproxy"
@@ -41,16 +42,29 @@ import (
 var dashboardTemplate = template.Must(template.ParseFS(content, "templates/dashboard.html"))
 
 type dashboard struct {
-	Modules   []allowedModuleInfo
-	BuildInfo *debug.BuildInfo
+	Modules          []allowedModuleInfo
+	Denied           []AllowedModule
+	CanApprove       bool
+	HasLicensePolicy bool // if false, licenses are not detected or shown
+	SumDBFailures    []sumDBFailure
+	BuildInfo        *debug.BuildInfo
 }
 
 type allowedModuleInfo struct {
 	AllowedModule
-	CurrentInfo *goproxy.ModuleInfo
-	CurrentErr  error
-	LatestInfo  *goproxy.ModuleInfo
-	LatestErr   error
+	CurrentInfo      *goproxy.ModuleInfo
+	CurrentErr       error
+	LatestInfo       *goproxy.ModuleInfo
+	LatestErr        error
+	LatestEligibleAt time.Time   // if non-zero, the time at which the latest version becomes old enough to be allowed
+	Retraction       *Retraction // if non-nil, Version has been retracted by the module's author
+	Licenses         []string    // licenses of Version if set, or else of the latest version
+	LicensesErr      error
+	LicenseDenied    string // if non-empty, a license in Licenses which is not allowed by the license policy
+}
+
+func (mod *allowedModuleInfo) LatestHeldBack() bool {
+	return mod.LatestEligibleAt.After(time.Now())
 }
 
 func (mod *allowedModuleInfo) OutOfDate() bool {
@@ -69,12 +83,12 @@ func (mod *allowedModuleInfo) VCSDiff() string {
 	}
 }
 
-func processModuleInfoResponse(resp *http.Response, err error) (*goproxy.ModuleInfo, error) {
+func processModuleInfoResponse(body io.ReadCloser, err error) (*goproxy.ModuleInfo, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error communicating with upstream proxy: %w", err)
 	}
-	respBody, err := io.ReadAll(resp.Body)
-	resp.Body.Close()
+	respBody, err := io.ReadAll(body)
+	body.Close()
 	if err != nil {
 		return nil, fmt.Errorf("error communicating with upstream proxy: %w", err)
 	}
@@ -95,18 +109,34 @@ func (s *Server) getLatestModuleInfo(ctx context.Context, module goproxy.ModuleP
 	return processModuleInfoResponse(s.requestUpstream(ctx, module, goproxy.LatestRequest{}))
 }
 
+// getAllowedModuleLicenses detects the licenses of the given version of mod, if there is a
+// license policy.  Otherwise, it does nothing, since detecting licenses requires downloading
+// the whole zip file of every module version on the dashboard.
+func (s *Server) getAllowedModuleLicenses(ctx context.Context, mod *allowedModuleInfo, version goproxy.ModuleVersion) {
+	if s.LicensePolicy == nil {
+		return
+	}
+	mod.Licenses, mod.LicensesErr = s.getModuleLicenses(ctx, mod.Path, version)
+	if mod.LicensesErr == nil {
+		mod.LicenseDenied = s.LicensePolicy.check(mod.Licenses)
+	}
+}
+
 func (s *Server) getAllowedModulesInfo(ctx context.Context) ([]allowedModuleInfo, error) {
-	modules := make([]allowedModuleInfo, len(s.AllowedModules))
+	defer s.getMetrics().dashboardRefresh.observeSince(time.Now())
+	allowlist := s.getAllowlist()
+	allowedModules := allowlist.Modules()
+	modules := make([]allowedModuleInfo, len(allowedModules))
 	group, ctx := errgroup.WithContext(ctx)
 	group.SetLimit(11)
 	group.Go(func() error {
-		for i := range s.AllowedModules {
+		for i := range allowedModules {
 			i := i
 			if ctx.Err() != nil {
 				return ctx.Err()
 			}
-			modules[i].AllowedModule = s.AllowedModules[i]
-			if modules[i].Path.IsEmpty() {
+			modules[i].AllowedModule = allowedModules[i]
+			if modules[i].Path.IsEmpty() || modules[i].Deny {
 				continue
 			}
 			if modules[i].Version.IsSet() {
@@ -114,9 +144,28 @@ func (s *Server) getAllowedModulesInfo(ctx context.Context) ([]allowedModuleInfo
 					modules[i].CurrentInfo, modules[i].CurrentErr = s.getModuleInfo(ctx, modules[i].Path, modules[i].Version)
 					return nil
 				})
+				group.Go(func() error {
+					if retractions, err := s.getRetractions(ctx, modules[i].Path); err == nil {
+						modules[i].Retraction = findRetraction(retractions, modules[i].Version)
+					}
+					return nil
+				})
+				group.Go(func() error {
+					s.getAllowedModuleLicenses(ctx, &modules[i], modules[i].Version)
+					return nil
+				})
 			}
 			group.Go(func() error {
 				modules[i].LatestInfo, modules[i].LatestErr = s.getLatestModuleInfo(ctx, modules[i].Path)
+				if modules[i].LatestInfo != nil && modules[i].Version.IsEmpty() {
+					s.getAllowedModuleLicenses(ctx, &modules[i], modules[i].LatestInfo.Version)
+				}
+				if modules[i].LatestInfo != nil {
+					rules := allowlist.rules(modules[i].Path)
+					if minAge := rules.minAge(modules[i].LatestInfo.Version, s.MinAge); minAge > 0 {
+						modules[i].LatestEligibleAt = modules[i].LatestInfo.Time.Add(minAge)
+					}
+				}
 				return nil
 			})
 		}
@@ -146,11 +195,20 @@ func (s *Server) serveDashboard(w http.ResponseWriter, req *http.Request) {
 
 	var dash dashboard
 	dash.BuildInfo, _ = debug.ReadBuildInfo()
+	dash.CanApprove = s.Approvers != nil && s.AllowlistFile != ""
+	dash.HasLicensePolicy = s.LicensePolicy != nil
+	dash.SumDBFailures = s.getSumDBFailures()
 	if modules, err := s.getAllowedModulesInfo(req.Context()); err != nil {
 		http.Error(w, fmt.Sprintf("error getting allowed modules info: %s", err), http.StatusInternalServerError)
 		return
 	} else {
-		dash.Modules = modules
+		for _, module := range modules {
+			if module.Deny {
+				dash.Denied = append(dash.Denied, module.AllowedModule)
+			} else {
+				dash.Modules = append(dash.Modules, module)
+			}
+		}
 	}
 
 	w.Header().Set("Content-Type", "text/html")
@@ -0,0 +1,216 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+var deniedTemplate = template.Must(template.ParseFS(content, "templates/denied.html"))
+
+const (
+	// Maximum number of denied module versions to remember; when exceeded, the one
+	// seen least recently is forgotten
+	maxDeniedRequests = 1000
+
+	// Maximum number of distinct clients to remember for each denied module version
+	maxDeniedClients = 10
+)
+
+type deniedRequest struct {
+	Path      goproxy.ModulePath
+	Version   goproxy.ModuleVersion // empty if the module's latest version was requested
+	Count     uint64
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Clients   []string // most recent first
+}
+
+type deniedRequestInfo struct {
+	deniedRequest
+	DiffOld goproxy.ModuleVersion // if set, the nearest allowed version, to diff DiffNew against
+	DiffNew goproxy.ModuleVersion // if set, the denied version, or the latest version if Version is empty
+	DiffErr error
+}
+
+// clientDescription returns a description of the client which made req, for
+// display in the denied request queue
+func clientDescription(req *http.Request) string {
+	client := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(client); err == nil {
+		client = host
+	}
+	if user, _, ok := req.BasicAuth(); ok {
+		client = user + "@" + client
+	}
+	if userAgent := req.UserAgent(); userAgent != "" {
+		client += " (" + userAgent + ")"
+	}
+	return client
+}
+
+// recordDenial adds a request for a module version which the allowlist does not allow
+// to the denied request queue
+func (s *Server) recordDenial(req *http.Request, module goproxy.ModulePath, version goproxy.ModuleVersion) {
+	client := clientDescription(req)
+	now := time.Now()
+	key := moduleVersion{Path: module, Version: version}
+
+	s.deniedMu.Lock()
+	defer s.deniedMu.Unlock()
+
+	if s.denied == nil {
+		s.denied = make(map[moduleVersion]*deniedRequest)
+	}
+	denial := s.denied[key]
+	if denial == nil {
+		if len(s.denied) >= maxDeniedRequests {
+			var oldest moduleVersion
+			for mv, d := range s.denied {
+				if oldest.Path.IsEmpty() || d.LastSeen.Before(s.denied[oldest].LastSeen) {
+					oldest = mv
+				}
+			}
+			delete(s.denied, oldest)
+		}
+		denial = &deniedRequest{Path: module, Version: version, FirstSeen: now}
+		s.denied[key] = denial
+	}
+	denial.Count++
+	denial.LastSeen = now
+	denial.Clients = slices.DeleteFunc(denial.Clients, func(c string) bool { return c == client })
+	denial.Clients = slices.Insert(denial.Clients, 0, client)
+	if len(denial.Clients) > maxDeniedClients {
+		denial.Clients = denial.Clients[:maxDeniedClients]
+	}
+}
+
+// getDeniedRequests returns the denied requests which the allowlist still does not
+// allow, most recently seen first
+func (s *Server) getDeniedRequests() []deniedRequest {
+	allowlist := s.getAllowlist()
+
+	s.deniedMu.Lock()
+	defer s.deniedMu.Unlock()
+
+	denials := []deniedRequest{}
+	for _, denial := range s.denied {
+		if denial.Version.IsSet() && allowlist.IsAllowed(denial.Path, denial.Version) {
+			continue
+		}
+		if rules := allowlist.rules(denial.Path); denial.Version.IsEmpty() && !rules.allow.isEmpty() && !rules.deny.all {
+			continue
+		}
+		d := *denial
+		d.Clients = slices.Clone(denial.Clients)
+		denials = append(denials, d)
+	}
+	slices.SortFunc(denials, func(a, b deniedRequest) int {
+		return b.LastSeen.Compare(a.LastSeen)
+	})
+	return denials
+}
+
+// nearestAllowedVersion returns the highest allowed version of the module that is lower
+// than version, or if there is none, the lowest allowed version that is higher than version,
+// or the empty version if no version of the module is allowed
+func (s *Server) nearestAllowedVersion(ctx context.Context, module goproxy.ModulePath, version goproxy.ModuleVersion) (goproxy.ModuleVersion, error) {
+	rules := s.getAllowlist().rules(module)
+	if rules.allow.isEmpty() {
+		return "", nil
+	}
+	versions, err := s.requestListFromUpstream(ctx, module)
+	if err != nil {
+		return "", err
+	}
+	versions = append(versions, rules.pinned...)
+
+	var below, above goproxy.ModuleVersion
+	for _, v := range versions {
+		if !rules.isAllowed(v) {
+			continue
+		}
+		if c := v.Compare(version); c < 0 && (below.IsEmpty() || v.Compare(below) > 0) {
+			below = v
+		} else if c > 0 && (above.IsEmpty() || v.Compare(above) < 0) {
+			above = v
+		}
+	}
+	if below.IsSet() {
+		return below, nil
+	}
+	return above, nil
+}
+
+func (s *Server) getDeniedRequestsInfo(ctx context.Context) []deniedRequestInfo {
+	denials := s.getDeniedRequests()
+	infos := make([]deniedRequestInfo, len(denials))
+	var group errgroup.Group
+	group.SetLimit(10)
+	for i := range denials {
+		infos[i].deniedRequest = denials[i]
+		group.Go(func() error {
+			info := &infos[i]
+			info.DiffNew = info.Version
+			if info.DiffNew.IsEmpty() {
+				if info.DiffNew, info.DiffErr = s.getLatestVersion(ctx, info.Path); info.DiffErr != nil {
+					return nil
+				}
+			}
+			info.DiffOld, info.DiffErr = s.nearestAllowedVersion(ctx, info.Path, info.DiffNew)
+			return nil
+		})
+	}
+	group.Wait()
+	return infos
+}
+
+func (s *Server) serveDenied(w http.ResponseWriter, req *http.Request) {
+	denials := s.getDeniedRequests()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(denials)
+}
+
+func (s *Server) serveDeniedHTML(w http.ResponseWriter, req *http.Request) {
+	denials := s.getDeniedRequestsInfo(req.Context())
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Xss-Protection", "0")
+	w.WriteHeader(http.StatusOK)
+	deniedTemplate.Execute(w, denials)
+}
@@ -0,0 +1,193 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+func TestClientDescription(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		user       string
+		userAgent  string
+		want       string
+	}{
+		{remoteAddr: "192.0.2.1:1234", want: "192.0.2.1"},
+		{remoteAddr: "[2001:db8::1]:1234", want: "2001:db8::1"},
+		{remoteAddr: "192.0.2.1:1234", user: "alice", want: "alice@192.0.2.1"},
+		{remoteAddr: "192.0.2.1:1234", userAgent: "Go-http-client/1.1", want: "192.0.2.1 (Go-http-client/1.1)"},
+		{remoteAddr: "192.0.2.1:1234", user: "alice", userAgent: "Go-http-client/1.1", want: "alice@192.0.2.1 (Go-http-client/1.1)"},
+		{remoteAddr: "@", want: "@"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/proxy/example.com/m/@latest", nil)
+		req.RemoteAddr = test.remoteAddr
+		req.Header.Del("User-Agent")
+		if test.userAgent != "" {
+			req.Header.Set("User-Agent", test.userAgent)
+		}
+		if test.user != "" {
+			req.SetBasicAuth(test.user, "password")
+		}
+		if got := clientDescription(req); got != test.want {
+			t.Errorf("clientDescription(%q, %q, %q) = %q, want %q", test.remoteAddr, test.user, test.userAgent, got, test.want)
+		}
+	}
+}
+
+func TestDeniedRequests(t *testing.T) {
+	upstream := newTestUpstream(t, "v1.0.0", "v1.1.0")
+	s := newTestServer(t, upstream.URL, "example.com/allowed v1.0.0\n")
+	requests := []struct {
+		path       string
+		remoteAddr string
+	}{
+		{"/proxy/example.com/allowed/@v/v1.0.0.zip", "192.0.2.1:1"},
+		{"/proxy/example.com/allowed/@v/v1.1.0.zip", "192.0.2.1:1"},
+		{"/proxy/example.com/allowed/@v/v1.1.0.zip", "192.0.2.2:1"},
+		{"/proxy/example.com/allowed/@v/v1.1.0.zip", "192.0.2.1:1"},
+		{"/proxy/example.com/other/@latest", "192.0.2.3:1"},
+		{"/proxy/example.com/other/@v/list", "192.0.2.3:1"},
+	}
+	for _, request := range requests {
+		req := httptest.NewRequest(http.MethodGet, request.path, nil)
+		req.RemoteAddr = request.remoteAddr
+		req.Header.Del("User-Agent")
+		s.HTTPHandler().ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	type denial struct {
+		path    goproxy.ModulePath
+		version goproxy.ModuleVersion
+		count   uint64
+		clients []string
+	}
+	summarize := func() []denial {
+		var denials []denial
+		for _, d := range s.getDeniedRequests() {
+			denials = append(denials, denial{d.Path, d.Version, d.Count, d.Clients})
+		}
+		return denials
+	}
+	equal := func(a, b []denial) bool {
+		return slices.EqualFunc(a, b, func(x, y denial) bool {
+			return x.path == y.path && x.version == y.version && x.count == y.count && slices.Equal(x.clients, y.clients)
+		})
+	}
+
+	want := []denial{
+		{"example.com/other", "", 1, []string{"192.0.2.3"}},
+		{"example.com/allowed", "v1.1.0", 3, []string{"192.0.2.1", "192.0.2.2"}},
+	}
+	if got := summarize(); !equal(got, want) {
+		t.Errorf("getDeniedRequests returned %v, want %v", got, want)
+	}
+
+	rec := serveTestRequest(s, "/denied")
+	if rec.Code != http.StatusOK || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("/denied returned status %d and Access-Control-Allow-Origin %q, want 200 and no header", rec.Code, rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+
+	// denials are hidden once the allowlist allows them
+	modules, err := ReadAllowedModules(strings.NewReader("example.com/allowed *\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetAllowedModules(modules)
+	want = []denial{
+		{"example.com/other", "", 1, []string{"192.0.2.3"}},
+	}
+	if got := summarize(); !equal(got, want) {
+		t.Errorf("after changing allowlist, getDeniedRequests returned %v, want %v", got, want)
+	}
+}
+
+func TestRecordDenialLimits(t *testing.T) {
+	s := newTestServer(t, "https://proxy.golang.org", "")
+	for i := 0; i < maxDeniedClients+2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/proxy/example.com/m/@latest", nil)
+		req.RemoteAddr = fmt.Sprintf("192.0.2.%d:1", i)
+		req.Header.Del("User-Agent")
+		s.recordDenial(req, "example.com/m", "v1.0.0")
+	}
+	clients := s.denied[moduleVersion{"example.com/m", "v1.0.0"}].Clients
+	if len(clients) != maxDeniedClients || clients[0] != fmt.Sprintf("192.0.2.%d", maxDeniedClients+1) {
+		t.Errorf("clients = %v, want the %d most recent", clients, maxDeniedClients)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/proxy/example.com/m/@latest", nil)
+	for i := 1; i < maxDeniedRequests; i++ {
+		s.recordDenial(req, "example.com/m", goproxy.ModuleVersion(fmt.Sprintf("v1.0.%d", i)))
+	}
+	oldest := moduleVersion{"example.com/m", "v1.0.5"}
+	s.denied[oldest].LastSeen = time.Now().Add(-time.Hour)
+	s.recordDenial(req, "example.com/m", "v2.0.0")
+	if len(s.denied) != maxDeniedRequests {
+		t.Errorf("%d denied requests remembered, want %d", len(s.denied), maxDeniedRequests)
+	}
+	if _, exists := s.denied[oldest]; exists {
+		t.Errorf("least recently seen denied request was not forgotten")
+	}
+}
+
+func TestNearestAllowedVersion(t *testing.T) {
+	upstream := newTestUpstream(t, "v1.0.0", "v1.1.0", "v1.2.0", "v1.3.0", "v2.0.0")
+	s := newTestServer(t, upstream.URL, `
+example.com/m >=v1.1.0 <v2.0.0
+!example.com/m v1.2.0
+example.com/pseudo v1.5.0-0.20240102030405-abcdefabcdef
+`)
+	tests := []struct {
+		module  goproxy.ModulePath
+		version goproxy.ModuleVersion
+		want    goproxy.ModuleVersion
+	}{
+		{"example.com/m", "v2.0.0", "v1.3.0"},
+		{"example.com/m", "v1.3.0", "v1.1.0"},
+		{"example.com/m", "v1.2.0", "v1.1.0"},
+		{"example.com/m", "v1.0.0", "v1.1.0"},
+		{"example.com/pseudo", "v1.6.0", "v1.5.0-0.20240102030405-abcdefabcdef"},
+		{"example.com/unlisted", "v1.0.0", ""},
+	}
+	for _, test := range tests {
+		got, err := s.nearestAllowedVersion(context.Background(), test.module, test.version)
+		if err != nil {
+			t.Errorf("nearestAllowedVersion(%s, %s) failed: %s", test.module, test.version, err)
+		} else if got != test.want {
+			t.Errorf("nearestAllowedVersion(%s, %s) = %q, want %q", test.module, test.version, got, test.want)
+		}
+	}
+}
@@ -38,6 +38,7 @@ import (
 	"strings"
 	"slices"
 	"sync"
+	"time"
 
 	"src.agwa.name/depproxy/internal/diff"
 	"src.agwa.name/depproxy/internal/diff/myers"
@@ -46,18 +47,26 @@ import (
 
 var diffTemplate = template.Must(template.ParseFS(content, "templates/diff.html"))
 
-func (s *Server) downloadUpstreamZip(ctx context.Context, module goproxy.ModulePath, version goproxy.ModuleVersion) (*zip.Reader, error) {
-	resp, err := s.requestUpstream(ctx, module, goproxy.ZipRequest{Version: version})
+func (s *Server) downloadUpstreamFile(ctx context.Context, module goproxy.ModulePath, req goproxy.Request) ([]byte, error) {
+	body, err := s.requestUpstream(ctx, module, req)
 	if err != nil {
 		return nil, fmt.Errorf("error communicating with upstream proxy: %w", err)
 	}
-	respBody, err := io.ReadAll(resp.Body)
-	resp.Body.Close()
+	respBody, err := io.ReadAll(body)
+	body.Close()
 	if err != nil {
 		return nil, fmt.Errorf("error communicating with upstream proxy: %w", err)
 	}
+	return respBody, nil
+}
 
-	reader, err := zip.NewReader(bytes.NewReader(respBody), int64(len(respBody)))
+func (s *Server) downloadUpstreamZip(ctx context.Context, module goproxy.ModulePath, version goproxy.ModuleVersion) (*zip.Reader, error) {
+	zipBytes, err := s.downloadUpstreamFile(ctx, module, goproxy.ZipRequest{Version: version})
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
 	if err != nil {
 		return nil, fmt.Errorf("error reading module zip file: %w", err)
 	}
@@ -153,10 +162,14 @@ func (s *Server) serveDiff(w http.ResponseWriter, req *http.Request) {
 		http.Error(w, "invalid module version: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	oldVer, err := goproxy.MakeModuleVersion(req.FormValue("old"))
-	if err != nil {
-		http.Error(w, "invalid module version: "+err.Error(), http.StatusBadRequest)
-		return
+	// If old is empty, the diff lists every file in the new version
+	var oldVer goproxy.ModuleVersion
+	if old := req.FormValue("old"); old != "" {
+		oldVer, err = goproxy.MakeModuleVersion(old)
+		if err != nil {
+			http.Error(w, "invalid module version: "+err.Error(), http.StatusBadRequest)
+			return
+		}
 	}
 	newVer, err := goproxy.MakeModuleVersion(req.FormValue("new"))
 	if err != nil {
@@ -164,14 +177,17 @@ func (s *Server) serveDiff(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	start := time.Now()
 	var oldZip, newZip *zip.Reader
 	var oldErr, newErr error
 	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		oldZip, oldErr = s.downloadUpstreamZip(req.Context(), module, oldVer)
-	}()
+	if oldVer.IsSet() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			oldZip, oldErr = s.downloadUpstreamZip(req.Context(), module, oldVer)
+		}()
+	}
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -193,11 +209,17 @@ func (s *Server) serveDiff(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	diff, err := makeDiff(module.String(), oldVer.String(), newVer.String(), oldZip.File, newZip.File)
+	var oldFiles []*zip.File
+	if oldZip != nil {
+		oldFiles = oldZip.File
+	}
+	diff, err := makeDiff(module.String(), oldVer.String(), newVer.String(), oldFiles, newZip.File)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("error making diff: %s", err), http.StatusInternalServerError)
 		return
 	}
+	s.getMetrics().diffDuration.observeSince(start)
+	s.getMetrics().diffSize.observe(float64(len(diff)))
 
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
@@ -0,0 +1,679 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	modzip "golang.org/x/mod/zip"
+
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+// Minimum time between fetches from a git repository
+const gitFetchInterval = time.Minute
+
+// A GitRewrite maps module paths beginning with Prefix to git repository URLs beginning with URL,
+// for modules which are fetched directly from git repositories
+type GitRewrite struct {
+	Prefix string
+	URL    string
+}
+
+// ParseGitRewrite parses a GitRewrite in the form PREFIX=URL
+func ParseGitRewrite(str string) (GitRewrite, error) {
+	prefix, url, found := strings.Cut(str, "=")
+	if !found || prefix == "" || url == "" {
+		return GitRewrite{}, fmt.Errorf("git rewrite rule must be in the form PREFIX=URL")
+	}
+	return GitRewrite{Prefix: strings.TrimSuffix(prefix, "/"), URL: strings.TrimSuffix(url, "/")}, nil
+}
+
+// gitRepoURL returns the URL of the git repository whose root contains the module with the given
+// path (without any major version suffix), using the longest matching rewrite rule.  If no rule
+// matches, false is returned: repositories are only fetched from URLs configured by a rewrite
+// rule, so that unauthenticated clients can't make depproxy clone arbitrary repositories.
+func (s *Server) gitRepoURL(path string) (string, bool) {
+	var best *GitRewrite
+	for i := range s.GitRewrites {
+		rewrite := &s.GitRewrites[i]
+		if (path == rewrite.Prefix || strings.HasPrefix(path, rewrite.Prefix+"/")) && (best == nil || len(rewrite.Prefix) > len(best.Prefix)) {
+			best = rewrite
+		}
+	}
+	if best == nil {
+		return "", false
+	}
+	return best.URL + strings.TrimPrefix(path, best.Prefix), true
+}
+
+// A gitRepo is a bare clone, stored in a subdirectory of Server.GitDir, of a remote git repository
+type gitRepo struct {
+	url string
+	dir string
+
+	fetchMu      sync.Mutex
+	lastFetch    time.Time         // time of the last fetch attempt, successful or not
+	lastFetchErr error             // error from the last fetch attempt
+	alertedTags  map[string]string // tag name => change to the tag that was alerted
+}
+
+func (s *Server) getGitRepo(url string) *gitRepo {
+	urlHash := sha256.Sum256([]byte(url))
+	repo, _ := s.gitRepos.LoadOrStore(url, &gitRepo{url: url, dir: filepath.Join(s.GitDir, hex.EncodeToString(urlHash[:]))})
+	return repo.(*gitRepo)
+}
+
+func (repo *gitRepo) git(ctx context.Context, args ...string) ([]byte, error) {
+	return repo.gitWithInput(ctx, nil, args...)
+}
+
+func (repo *gitRepo) gitWithInput(ctx context.Context, input []byte, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", repo.dir}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], message)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return out, nil
+}
+
+// fetch fetches the branches and tags of the remote repository, unless a fetch was attempted
+// within the last gitFetchInterval, in which case the error from that attempt is returned.
+// The remote's default branch is stored in refs/depproxy/HEAD.  Branches are updated to match
+// the remote, but tags are not (see updateTags).
+func (repo *gitRepo) fetch(ctx context.Context) error {
+	repo.fetchMu.Lock()
+	defer repo.fetchMu.Unlock()
+	if time.Since(repo.lastFetch) < gitFetchInterval {
+		return repo.lastFetchErr
+	}
+	err := repo.fetchNow(ctx)
+	if ctx.Err() != nil {
+		// The attempt was cut short by the request being canceled, so don't hold it against the remote
+		return err
+	}
+	repo.lastFetch, repo.lastFetchErr = time.Now(), err
+	return err
+}
+
+func (repo *gitRepo) fetchNow(ctx context.Context) error {
+	if _, err := os.Stat(filepath.Join(repo.dir, "HEAD")); errors.Is(err, fs.ErrNotExist) {
+		if err := os.MkdirAll(repo.dir, 0755); err != nil {
+			return err
+		}
+		if _, err := repo.git(ctx, "init", "--quiet", "--bare"); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	if _, err := repo.git(ctx, "fetch", "--quiet", "--prune", "--no-tags", repo.url, "+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/depproxy/tags/*", "+HEAD:refs/depproxy/HEAD"); err != nil {
+		return fmt.Errorf("error fetching %s: %w", repo.url, err)
+	}
+	if err := repo.updateTags(ctx); err != nil {
+		return fmt.Errorf("error updating tags from %s: %w", repo.url, err)
+	}
+	return nil
+}
+
+// A gitRef is the object that a ref points to, and the commit that the object peels to
+type gitRef struct {
+	object string
+	commit string
+}
+
+// refs returns the refs beginning with prefix, keyed by their names without the prefix
+func (repo *gitRepo) refs(ctx context.Context, prefix string) (map[string]gitRef, error) {
+	out, err := repo.git(ctx, "for-each-ref", "--format=%(refname) %(objectname) %(*objectname)", prefix)
+	if err != nil {
+		return nil, err
+	}
+	refs := make(map[string]gitRef)
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		f := strings.Fields(line)
+		if len(f) < 2 {
+			continue
+		}
+		ref := gitRef{object: f[1], commit: f[1]}
+		if len(f) == 3 {
+			ref.commit = f[2]
+		}
+		refs[strings.TrimPrefix(f[0], prefix)] = ref
+	}
+	return refs, nil
+}
+
+// updateTags creates a tag in refs/tags for every tag fetched into refs/depproxy/tags that
+// doesn't already exist.  Since module versions must be immutable, tags in refs/tags are never
+// moved or deleted.  If the remote repository moves or deletes a tag, the previously-fetched
+// tag continues to be used, and an alert is logged.
+func (repo *gitRepo) updateTags(ctx context.Context) error {
+	local, err := repo.refs(ctx, "refs/tags/")
+	if err != nil {
+		return err
+	}
+	remote, err := repo.refs(ctx, "refs/depproxy/tags/")
+	if err != nil {
+		return err
+	}
+	var create bytes.Buffer
+	for name, remoteRef := range remote {
+		if localRef, exists := local[name]; !exists {
+			fmt.Fprintf(&create, "create refs/tags/%s %s\n", name, remoteRef.object)
+		} else if localRef.commit != remoteRef.commit {
+			repo.alertTag(name, "moved to commit "+remoteRef.commit, localRef.commit)
+		}
+	}
+	for name, localRef := range local {
+		if _, exists := remote[name]; !exists {
+			repo.alertTag(name, "been deleted", localRef.commit)
+		}
+	}
+	if create.Len() == 0 {
+		return nil
+	}
+	_, err = repo.gitWithInput(ctx, create.Bytes(), "update-ref", "--stdin")
+	return err
+}
+
+// alertTag logs an alert that the remote repository has changed a tag, unless the same
+// change was already alerted.  The caller must hold fetchMu.
+func (repo *gitRepo) alertTag(name string, change string, commit string) {
+	if repo.alertedTags[name] == change {
+		return
+	}
+	log.Printf("ALERT: tag %s in %s has %s; continuing to use commit %s", name, repo.url, change, commit)
+	if repo.alertedTags == nil {
+		repo.alertedTags = make(map[string]string)
+	}
+	repo.alertedTags[name] = change
+}
+
+// resolve returns the full hash of the commit identified by rev, after fetching the repository
+// (subject to gitFetchInterval).  If fetching fails, rev is resolved using the refs and commits
+// that were previously fetched.  errNotFound is returned if there is no such commit.
+func (repo *gitRepo) resolve(ctx context.Context, rev string) (string, error) {
+	fetchErr := repo.fetch(ctx)
+	if out, err := repo.git(ctx, "rev-parse", "--verify", "--quiet", "--end-of-options", rev+"^{commit}"); err == nil {
+		return strings.TrimSpace(string(out)), nil
+	}
+	if fetchErr != nil {
+		return "", fetchErr
+	}
+	return "", errNotFound
+}
+
+func (repo *gitRepo) commitTime(ctx context.Context, commit string) (time.Time, error) {
+	out, err := repo.git(ctx, "show", "--no-patch", "--format=%ct", commit)
+	if err != nil {
+		return time.Time{}, err
+	}
+	seconds, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("malformed commit time %q", out)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// hasFile reports whether the file at path exists in the given commit
+func (repo *gitRepo) hasFile(ctx context.Context, commit string, path string) bool {
+	_, err := repo.git(ctx, "cat-file", "-e", commit+":"+path)
+	return err == nil
+}
+
+// readFile returns the contents of the file at path in the given commit, or errNotFound
+// if it doesn't exist
+func (repo *gitRepo) readFile(ctx context.Context, commit string, path string) ([]byte, error) {
+	if !repo.hasFile(ctx, commit, path) {
+		return nil, errNotFound
+	}
+	return repo.git(ctx, "cat-file", "blob", commit+":"+path)
+}
+
+// tags returns the tags of the repository which are valid module versions.  If merged is
+// non-empty, only tags which are ancestors of that commit are returned.
+func (repo *gitRepo) tags(ctx context.Context, merged string) ([]string, error) {
+	args := []string{"tag", "--list"}
+	if merged != "" {
+		args = append(args, "--merged", merged)
+	}
+	out, err := repo.git(ctx, append(args, "v*")...)
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	for _, tag := range strings.Fields(string(out)) {
+		if semver.IsValid(tag) && semver.Canonical(tag) == tag && !module.IsPseudoVersion(tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+// A gitModule is a module which is fetched directly from the root of a git repository, or from
+// the major version subdirectory (e.g. v2/) of the repository
+type gitModule struct {
+	path      goproxy.ModulePath
+	pathMajor string // major version suffix of path, such as /v2, or empty
+	repo      *gitRepo
+}
+
+func (s *Server) getGitModule(path goproxy.ModulePath) (*gitModule, error) {
+	prefix, pathMajor, ok := module.SplitPathVersion(path.String())
+	if !ok || strings.HasPrefix(pathMajor, ".") {
+		return nil, fmt.Errorf("module path %s is not supported by the direct upstream", path)
+	}
+	url, ok := s.gitRepoURL(prefix)
+	if !ok {
+		return nil, fmt.Errorf("no git rewrite rule matches module %s: %w", path, errNotFound)
+	}
+	return &gitModule{
+		path:      path,
+		pathMajor: pathMajor,
+		repo:      s.getGitRepo(url),
+	}, nil
+}
+
+// isValidVersion reports whether version is a canonical version (possibly a pseudo-version) of
+// the module.  As in the go command, a version of a module without a major version suffix must
+// have the +incompatible suffix if and only if its major version is 2 or higher.
+func (m *gitModule) isValidVersion(version string) bool {
+	if module.CanonicalVersion(version) != version || module.CheckPathMajor(version, m.pathMajor) != nil {
+		return false
+	}
+	major := semver.Major(version)
+	return isIncompatibleVersion(version) == (m.pathMajor == "" && major != "v0" && major != "v1")
+}
+
+func isIncompatibleVersion(version string) bool {
+	return strings.HasSuffix(version, "+incompatible")
+}
+
+// versionTag returns the tag for the given non-pseudo version
+func versionTag(version string) string {
+	return "refs/tags/" + strings.TrimSuffix(version, "+incompatible")
+}
+
+// versions returns the tagged versions of the module.  Like the go command, tags with a major
+// version of 2 or higher are listed as +incompatible versions of a module without a major version
+// suffix, provided that the tagged commit has no go.mod file, and that the latest v0 or v1 version
+// (if any) has no go.mod file either.
+func (m *gitModule) versions(ctx context.Context) ([]goproxy.ModuleVersion, error) {
+	if err := m.repo.fetch(ctx); err != nil {
+		return nil, err
+	}
+	tags, err := m.repo.tags(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	versions := []goproxy.ModuleVersion{}
+	var incompatible []string
+	for _, tag := range tags {
+		if m.isValidVersion(tag) {
+			versions = append(versions, goproxy.ModuleVersion(tag))
+		} else if m.isValidVersion(tag + "+incompatible") {
+			incompatible = append(incompatible, tag+"+incompatible")
+		}
+	}
+	if len(incompatible) > 0 {
+		if latest := latestVersion(versions); latest.IsSet() && m.repo.hasFile(ctx, versionTag(latest.String()), "go.mod") {
+			return versions, nil
+		}
+		for _, version := range incompatible {
+			if !m.repo.hasFile(ctx, versionTag(version), "go.mod") {
+				versions = append(versions, goproxy.ModuleVersion(version))
+			}
+		}
+	}
+	return versions, nil
+}
+
+// resolveVersion returns the commit of the given module version, which is either a tag or a
+// pseudo-version.  Pseudo-versions are checked the same way the go command checks them.
+// +incompatible versions are only valid for commits without a go.mod file.
+func (m *gitModule) resolveVersion(ctx context.Context, version string) (string, error) {
+	if !m.isValidVersion(version) {
+		return "", errNotFound
+	}
+	var commit string
+	var err error
+	if module.IsPseudoVersion(version) {
+		commit, err = m.resolvePseudoVersion(ctx, version)
+	} else {
+		commit, err = m.repo.resolve(ctx, versionTag(version))
+	}
+	if err != nil {
+		return "", err
+	}
+	if isIncompatibleVersion(version) && m.repo.hasFile(ctx, commit, "go.mod") {
+		return "", fmt.Errorf("version %s is invalid: the +incompatible suffix is not allowed because commit %s has a go.mod file", version, commit)
+	}
+	return commit, nil
+}
+
+func (m *gitModule) resolvePseudoVersion(ctx context.Context, version string) (string, error) {
+	rev, err := module.PseudoVersionRev(version)
+	if err != nil {
+		return "", err
+	}
+	commit, err := m.repo.resolve(ctx, rev)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(commit, rev) {
+		return "", errNotFound
+	}
+	versionTime, err := module.PseudoVersionTime(version)
+	if err != nil {
+		return "", err
+	}
+	if commitTime, err := m.repo.commitTime(ctx, commit); err != nil {
+		return "", err
+	} else if !commitTime.Equal(versionTime) {
+		return "", fmt.Errorf("pseudo-version %s does not match the commit time (%s)", version, commitTime.Format(module.PseudoVersionTimestampFormat))
+	}
+	if base, err := module.PseudoVersionBase(version); err != nil {
+		return "", err
+	} else if base != "" {
+		baseCommit, err := m.repo.resolve(ctx, versionTag(base))
+		if errors.Is(err, errNotFound) {
+			return "", fmt.Errorf("pseudo-version %s is based on %s, which is not tagged", version, base)
+		} else if err != nil {
+			return "", err
+		}
+		if _, err := m.repo.git(ctx, "merge-base", "--is-ancestor", baseCommit, commit); err != nil || baseCommit == commit {
+			return "", fmt.Errorf("pseudo-version %s is based on %s, which is not an ancestor of the commit", version, base)
+		}
+	}
+	return commit, nil
+}
+
+// pseudoVersion returns the version of the given commit: the tag of the commit if it is tagged
+// with a version, or else a pseudo-version based on the highest tagged ancestor.  If the module
+// has no major version suffix and the commit has no go.mod file, tags with a major version of
+// 2 or higher are treated as +incompatible versions.
+func (m *gitModule) pseudoVersion(ctx context.Context, commit string) (string, error) {
+	tags, err := m.repo.tags(ctx, commit)
+	if err != nil {
+		return "", err
+	}
+	canBeIncompatible := m.pathMajor == "" && !m.repo.hasFile(ctx, commit, "go.mod")
+	var base string
+	for _, tag := range tags {
+		version := tag
+		if !m.isValidVersion(version) {
+			version = tag + "+incompatible"
+			if !canBeIncompatible || !m.isValidVersion(version) {
+				continue
+			}
+		}
+		if tagCommit, err := m.repo.resolve(ctx, versionTag(version)); err == nil && tagCommit == commit {
+			return version, nil
+		}
+		if base == "" || semver.Compare(version, base) > 0 {
+			base = version
+		}
+	}
+	commitTime, err := m.repo.commitTime(ctx, commit)
+	if err != nil {
+		return "", err
+	}
+	return module.PseudoVersion(strings.TrimPrefix(m.pathMajor, "/"), base, commitTime, commit[:12]), nil
+}
+
+func (m *gitModule) info(ctx context.Context, version string, commit string) ([]byte, error) {
+	commitTime, err := m.repo.commitTime(ctx, commit)
+	if err != nil {
+		return nil, err
+	}
+	info := goproxy.ModuleInfo{
+		Version: goproxy.ModuleVersion(version),
+		Time:    commitTime,
+		Origin:  &goproxy.ModuleOrigin{VCS: "git", URL: m.repo.url, Hash: commit},
+	}
+	if !module.IsPseudoVersion(version) {
+		info.Origin.Ref = versionTag(version)
+	}
+	return json.Marshal(info)
+}
+
+// query returns the version of the module for the given query, which may be a version, a
+// branch name, or a commit hash (or prefix thereof).  Like the go command, proxies respond to
+// .info requests for such queries with the canonical version.
+func (m *gitModule) query(ctx context.Context, query string) (string, string, error) {
+	if semver.IsValid(query) {
+		version := query
+		if !m.isValidVersion(version) && m.isValidVersion(version+"+incompatible") {
+			version += "+incompatible"
+		}
+		commit, err := m.resolveVersion(ctx, version)
+		return version, commit, err
+	}
+	commit, err := m.repo.resolve(ctx, query)
+	if err != nil {
+		return "", "", err
+	}
+	version, err := m.pseudoVersion(ctx, commit)
+	return version, commit, err
+}
+
+// latest returns the latest version of the module, or if no version is tagged, a pseudo-version
+// for the latest commit on the default branch
+func (m *gitModule) latest(ctx context.Context) (string, string, error) {
+	versions, err := m.versions(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	if latest := latestVersion(versions); latest.IsSet() {
+		commit, err := m.resolveVersion(ctx, latest.String())
+		return latest.String(), commit, err
+	}
+	commit, err := m.repo.resolve(ctx, "refs/depproxy/HEAD")
+	if err != nil {
+		return "", "", err
+	}
+	version, err := m.pseudoVersion(ctx, commit)
+	return version, commit, err
+}
+
+// subdir returns the directory of the repository containing the module at the given commit:
+// the major version subdirectory if it contains a go.mod file, or else the root
+func (m *gitModule) subdir(ctx context.Context, commit string) string {
+	if m.pathMajor != "" {
+		subdir := strings.TrimPrefix(m.pathMajor, "/")
+		if _, err := m.repo.readFile(ctx, commit, subdir+"/go.mod"); err == nil {
+			return subdir
+		}
+	}
+	return ""
+}
+
+// goMod returns the go.mod file of the module at the given commit.  If there is no go.mod file
+// and the module path has no major version suffix, a go.mod file is synthesized, like the go
+// command does.
+func (m *gitModule) goMod(ctx context.Context, commit string) ([]byte, error) {
+	goModPath := "go.mod"
+	if subdir := m.subdir(ctx, commit); subdir != "" {
+		goModPath = subdir + "/go.mod"
+	}
+	goMod, err := m.repo.readFile(ctx, commit, goModPath)
+	if errors.Is(err, errNotFound) && m.pathMajor == "" {
+		return fmt.Appendf(nil, "module %s\n", modfile.AutoQuote(m.path.String())), nil
+	} else if err != nil {
+		return nil, err
+	}
+	if modulePath := modfile.ModulePath(goMod); modulePath != m.path.String() {
+		return nil, fmt.Errorf("go.mod at %s declares module path %q, not %q", commit, modulePath, m.path)
+	}
+	return goMod, nil
+}
+
+// zip returns the module zip file for the given version of the module at the given commit
+func (m *gitModule) zip(ctx context.Context, version string, commit string) ([]byte, error) {
+	if _, err := m.goMod(ctx, commit); err != nil {
+		return nil, err
+	}
+	subdir := m.subdir(ctx, commit)
+	args := []string{"-c", "core.autocrlf=input", "-c", "core.eol=lf", "archive", "--format=zip", commit}
+	if subdir != "" {
+		args = append(args, subdir)
+	}
+	archive, err := m.repo.git(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	archiveReader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, err
+	}
+
+	var files []modzip.File
+	haveLicense := false
+	for _, file := range archiveReader.File {
+		name := file.Name
+		if subdir != "" {
+			var found bool
+			if name, found = strings.CutPrefix(name, subdir+"/"); !found {
+				continue
+			}
+		}
+		if name == "" || strings.HasSuffix(name, "/") {
+			continue
+		}
+		files = append(files, gitArchiveFile{name: name, file: file})
+		haveLicense = haveLicense || name == "LICENSE"
+	}
+	if subdir != "" && !haveLicense {
+		// Like the go command, include the repository's LICENSE file in modules in subdirectories
+		if license, err := m.repo.readFile(ctx, commit, "LICENSE"); err == nil {
+			files = append(files, gitLicenseFile(license))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := modzip.Create(&buf, module.Version{Path: m.path.String(), Version: version}, files); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// gitArchiveFile implements modzip.File for a file in an archive created by git archive
+type gitArchiveFile struct {
+	name string
+	file *zip.File
+}
+
+func (f gitArchiveFile) Path() string                 { return f.name }
+func (f gitArchiveFile) Lstat() (fs.FileInfo, error)  { return f.file.FileInfo(), nil }
+func (f gitArchiveFile) Open() (io.ReadCloser, error) { return f.file.Open() }
+
+// gitLicenseFile implements modzip.File for the LICENSE file from a repository's root
+type gitLicenseFile []byte
+
+func (f gitLicenseFile) Path() string                 { return "LICENSE" }
+func (f gitLicenseFile) Lstat() (fs.FileInfo, error)  { return f, nil }
+func (f gitLicenseFile) Open() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(f)), nil }
+func (f gitLicenseFile) Name() string                 { return "LICENSE" }
+func (f gitLicenseFile) Size() int64                  { return int64(len(f)) }
+func (f gitLicenseFile) Mode() fs.FileMode            { return 0644 }
+func (f gitLicenseFile) ModTime() time.Time           { return time.Time{} }
+func (f gitLicenseFile) IsDir() bool                  { return false }
+func (f gitLicenseFile) Sys() any                     { return nil }
+
+// requestGitUpstream answers req for module from the module's git repository
+func (s *Server) requestGitUpstream(ctx context.Context, path goproxy.ModulePath, req goproxy.Request) ([]byte, error) {
+	m, err := s.getGitModule(path)
+	if err != nil {
+		return nil, err
+	}
+	switch req := req.(type) {
+	case goproxy.ListRequest:
+		versions, err := m.versions(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var list bytes.Buffer
+		for _, version := range versions {
+			list.WriteString(version.String() + "\n")
+		}
+		return list.Bytes(), nil
+	case goproxy.LatestRequest:
+		version, commit, err := m.latest(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return m.info(ctx, version, commit)
+	case goproxy.InfoRequest:
+		version, commit, err := m.query(ctx, req.Version.String())
+		if err != nil {
+			return nil, err
+		}
+		return m.info(ctx, version, commit)
+	case goproxy.ModRequest:
+		commit, err := m.resolveVersion(ctx, req.Version.String())
+		if err != nil {
+			return nil, err
+		}
+		return m.goMod(ctx, commit)
+	case goproxy.ZipRequest:
+		commit, err := m.resolveVersion(ctx, req.Version.String())
+		if err != nil {
+			return nil, err
+		}
+		return m.zip(ctx, req.Version.String(), commit)
+	default:
+		return nil, fmt.Errorf("unsupported request")
+	}
+}
@@ -0,0 +1,616 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/dirhash"
+	modzip "golang.org/x/mod/zip"
+
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+// A gitFixture is a working repository whose refs are pushed to a bare repository,
+// which serves as the remote repository of a module in tests
+type gitFixture struct {
+	t    *testing.T
+	work string
+	bare string
+}
+
+func newGitFixture(t *testing.T) *gitFixture {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	f := &gitFixture{t: t, work: t.TempDir(), bare: t.TempDir()}
+	f.git(f.work, "init", "--quiet", "--initial-branch=main")
+	f.git(f.bare, "init", "--quiet", "--bare", "--initial-branch=main")
+	return f
+}
+
+func (f *gitFixture) git(dir string, args ...string) string {
+	f.t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=Test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false", "-c", "tag.gpgsign=false"}, args...)...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		f.t.Fatalf("git %s: %s\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// commit commits the given files (in addition to the files already committed) with the
+// given commit time, pushes all refs to the bare repository, and returns the commit hash
+func (f *gitFixture) commit(files map[string]string, when time.Time) string {
+	f.t.Helper()
+	for name, content := range files {
+		filename := filepath.Join(f.work, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			f.t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+			f.t.Fatal(err)
+		}
+	}
+	f.git(f.work, "add", "--all")
+	date := when.UTC().Format(time.RFC3339)
+	cmd := exec.Command("git", "-C", f.work, "-c", "user.name=Test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false", "commit", "--quiet", "--allow-empty", "--message=commit")
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		f.t.Fatalf("git commit: %s\n%s", err, out)
+	}
+	f.push()
+	return f.git(f.work, "rev-parse", "HEAD")
+}
+
+// tag creates or moves the given lightweight tag to commit and pushes it to the bare repository
+func (f *gitFixture) tag(name string, commit string) {
+	f.t.Helper()
+	f.git(f.work, "tag", "--force", name, commit)
+	f.push()
+}
+
+// deleteTag deletes the given tag from the bare repository
+func (f *gitFixture) deleteTag(name string) {
+	f.t.Helper()
+	f.git(f.work, "tag", "--delete", name)
+	f.push()
+}
+
+func (f *gitFixture) push() {
+	f.t.Helper()
+	f.git(f.work, "push", "--quiet", "--mirror", f.bare)
+}
+
+// server returns a Server which fetches modules beginning with prefix from the fixture
+func (f *gitFixture) server(prefix string) *Server {
+	return &Server{
+		GitDir:      f.t.TempDir(),
+		GitRewrites: []GitRewrite{{Prefix: prefix, URL: f.bare}},
+	}
+}
+
+func TestGitFetchDoesNotMoveTags(t *testing.T) {
+	f := newGitFixture(t)
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	commit1 := f.commit(map[string]string{"go.mod": "module example.com/m\n"}, start)
+	commit2 := f.commit(map[string]string{"a.go": "package m\n"}, start.Add(time.Hour))
+	f.tag("v1.0.0", commit1)
+	f.tag("v1.1.0", commit1)
+
+	var logOutput bytes.Buffer
+	log.SetOutput(&logOutput)
+	defer log.SetOutput(os.Stderr)
+
+	s := f.server("example.com/m")
+	url, ok := s.gitRepoURL("example.com/m")
+	if !ok {
+		t.Fatal("gitRepoURL found no rewrite rule")
+	}
+	repo := s.getGitRepo(url)
+	ctx := context.Background()
+	refetch := func() {
+		t.Helper()
+		repo.lastFetch = time.Time{}
+		if err := repo.fetch(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	refetch()
+
+	f.tag("v1.0.0", commit2)
+	f.deleteTag("v1.1.0")
+	f.tag("v1.2.0", commit2)
+	refetch()
+	refetch()
+
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{"v1.0.0", commit1},
+		{"v1.1.0", commit1},
+		{"v1.2.0", commit2},
+	}
+	for _, test := range tests {
+		if got, err := repo.resolve(ctx, "refs/tags/"+test.tag); err != nil {
+			t.Errorf("resolve(%s) failed: %s", test.tag, err)
+		} else if got != test.want {
+			t.Errorf("resolve(%s) = %s, want %s", test.tag, got, test.want)
+		}
+	}
+
+	alerts := strings.Count(logOutput.String(), "ALERT:")
+	if !strings.Contains(logOutput.String(), "tag v1.0.0 in "+f.bare+" has moved to commit "+commit2) {
+		t.Errorf("no alert logged for moved tag; log output: %s", logOutput.String())
+	}
+	if !strings.Contains(logOutput.String(), "tag v1.1.0 in "+f.bare+" has been deleted") {
+		t.Errorf("no alert logged for deleted tag; log output: %s", logOutput.String())
+	}
+	if alerts != 2 {
+		t.Errorf("%d alerts logged, want 2; log output: %s", alerts, logOutput.String())
+	}
+}
+
+func TestGitRepoURL(t *testing.T) {
+	s := &Server{GitRewrites: []GitRewrite{
+		{Prefix: "corp.example.com", URL: "ssh://git@git.corp.example.com"},
+		{Prefix: "corp.example.com/team", URL: "https://team.example.com/git"},
+	}}
+	tests := []struct {
+		path   string
+		want   string
+		wantOK bool
+	}{
+		{"corp.example.com/lib", "ssh://git@git.corp.example.com/lib", true},
+		{"corp.example.com", "ssh://git@git.corp.example.com", true},
+		{"corp.example.com/team/foo", "https://team.example.com/git/foo", true},
+		{"corp.example.com/teamwork", "ssh://git@git.corp.example.com/teamwork", true},
+		{"corp.example.community/lib", "", false},
+		{"github.com/example/lib", "", false},
+	}
+	for _, test := range tests {
+		if got, ok := s.gitRepoURL(test.path); got != test.want || ok != test.wantOK {
+			t.Errorf("gitRepoURL(%s) = %q, %v; want %q, %v", test.path, got, ok, test.want, test.wantOK)
+		}
+	}
+}
+
+func TestServeDirectRequiresRewrite(t *testing.T) {
+	s := newTestServer(t, "direct", "** *\n")
+	s.GitDir = t.TempDir()
+	s.GitRewrites = []GitRewrite{{Prefix: "corp.example.com", URL: t.TempDir()}}
+	for _, path := range []string{"/proxy/example.com/m/@v/list", "/proxy/example.com/m/@latest", "/proxy/example.com/m/@v/v1.0.0.info"} {
+		if rec := serveTestRequest(s, path); rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s returned %d %q, want %d", path, rec.Code, rec.Body.String(), http.StatusNotFound)
+		}
+	}
+	if entries, err := os.ReadDir(s.GitDir); err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 0 {
+		t.Errorf("git directory contains %d entries, want 0", len(entries))
+	}
+}
+
+func TestGitFetchBackoff(t *testing.T) {
+	f := newGitFixture(t)
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	f.commit(map[string]string{"go.mod": "module example.com/m\n"}, start)
+
+	s := f.server("example.com/m")
+	repo := s.getGitRepo(filepath.Join(t.TempDir(), "missing"))
+	ctx := context.Background()
+	if err := repo.fetch(ctx); err == nil {
+		t.Fatal("fetch from missing repository succeeded")
+	}
+	repo.url = f.bare
+	if err := repo.fetch(ctx); err == nil {
+		t.Error("second fetch within the fetch interval was attempted, want the previous error")
+	}
+	repo.lastFetch = time.Time{}
+	if err := repo.fetch(ctx); err != nil {
+		t.Errorf("fetch after the fetch interval failed: %s", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	repo.lastFetch = time.Time{}
+	if err := repo.fetch(canceled); err == nil {
+		t.Error("fetch with canceled context succeeded")
+	}
+	if err := repo.fetch(ctx); err != nil {
+		t.Errorf("fetch after canceled fetch failed: %s", err)
+	}
+}
+
+func TestGitIncompatibleVersions(t *testing.T) {
+	f := newGitFixture(t)
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	commit1 := f.commit(map[string]string{"m.go": "package m\n"}, start)
+	commit2 := f.commit(map[string]string{"m.go": "package m // v2\n"}, start.Add(1*time.Hour))
+	commit3 := f.commit(map[string]string{"m.go": "package m // v2.1\n"}, start.Add(2*time.Hour))
+	commit4 := f.commit(map[string]string{"go.mod": "module example.com/m\n"}, start.Add(3*time.Hour))
+	f.tag("v1.0.0", commit1)
+	f.tag("v2.0.0", commit2)
+	f.tag("v3.0.0", commit4)
+
+	s := f.server("example.com/m")
+	m, err := s.getGitModule("example.com/m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	versions, err := m.versions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(versions), "[v1.0.0 v2.0.0+incompatible]"; got != want {
+		t.Errorf("versions = %s, want %s", got, want)
+	}
+
+	queries := []struct {
+		query   string
+		version string
+		commit  string
+	}{
+		{"v2.0.0", "v2.0.0+incompatible", commit2},
+		{"v2.0.0+incompatible", "v2.0.0+incompatible", commit2},
+		{commit2, "v2.0.0+incompatible", commit2},
+		{commit3, "v2.0.1-0.20240102050405-" + commit3[:12] + "+incompatible", commit3},
+		{commit4, "v1.0.1-0.20240102060405-" + commit4[:12], commit4},
+		{"v3.0.0", "", ""},
+		{"v3.0.0+incompatible", "", ""},
+	}
+	for _, test := range queries {
+		version, commit, err := m.query(ctx, test.query)
+		if test.version == "" {
+			if err == nil {
+				t.Errorf("query(%s) = %s, want error", test.query, version)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("query(%s) failed: %s", test.query, err)
+		} else if version != test.version || commit != test.commit {
+			t.Errorf("query(%s) = %s %s, want %s %s", test.query, version, commit, test.version, test.commit)
+		}
+	}
+
+	resolves := []struct {
+		version string
+		commit  string
+	}{
+		{"v2.0.0+incompatible", commit2},
+		{"v2.0.1-0.20240102050405-" + commit3[:12] + "+incompatible", commit3},
+		{"v2.0.0", ""},
+		{"v1.0.0+incompatible", ""},
+		{"v3.0.0+incompatible", ""},
+		{"v3.0.1-0.20240102060405-" + commit4[:12] + "+incompatible", ""},
+	}
+	for _, test := range resolves {
+		commit, err := m.resolveVersion(ctx, test.version)
+		if test.commit == "" {
+			if err == nil {
+				t.Errorf("resolveVersion(%s) = %s, want error", test.version, commit)
+			}
+		} else if err != nil {
+			t.Errorf("resolveVersion(%s) failed: %s", test.version, err)
+		} else if commit != test.commit {
+			t.Errorf("resolveVersion(%s) = %s, want %s", test.version, commit, test.commit)
+		}
+	}
+
+	goMod, err := m.goMod(ctx, commit2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(goMod) != "module example.com/m\n" {
+		t.Errorf("goMod of v2.0.0+incompatible = %q", goMod)
+	}
+}
+
+func TestGitIncompatibleVersionsHiddenByGoMod(t *testing.T) {
+	f := newGitFixture(t)
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	commit1 := f.commit(map[string]string{"m.go": "package m\n"}, start)
+	commit2 := f.commit(map[string]string{"go.mod": "module example.com/m\n"}, start.Add(time.Hour))
+	f.tag("v2.0.0", commit1)
+	f.tag("v1.1.0", commit2)
+
+	m, err := f.server("example.com/m").getGitModule("example.com/m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err := m.versions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(versions), "[v1.1.0]"; got != want {
+		t.Errorf("versions = %s, want %s", got, want)
+	}
+}
+
+func TestGitVersions(t *testing.T) {
+	f := newGitFixture(t)
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	commit1 := f.commit(map[string]string{"go.mod": "module example.com/m\n"}, start)
+	commit2 := f.commit(map[string]string{"v2/go.mod": "module example.com/m/v2\n"}, start.Add(time.Hour))
+	for _, tag := range []string{"v1.0.0", "v1.1.0-beta.1", "v1.2", "release-1", "v0.0.0-20240102030405-abcdefabcdef"} {
+		f.tag(tag, commit1)
+	}
+	f.tag("v1.2.0", commit2)
+	f.tag("v2.0.0", commit2)
+	f.tag("v3.0.0", commit2)
+
+	s := f.server("example.com/m")
+	tests := []struct {
+		path goproxy.ModulePath
+		want string
+	}{
+		{"example.com/m", "[v1.0.0 v1.1.0-beta.1 v1.2.0]"},
+		{"example.com/m/v2", "[v2.0.0]"},
+		{"example.com/m/v3", "[v3.0.0]"},
+		{"example.com/m/v4", "[]"},
+	}
+	for _, test := range tests {
+		m, err := s.getGitModule(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		versions, err := m.versions(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(versions); got != test.want {
+			t.Errorf("versions of %s = %s, want %s", test.path, got, test.want)
+		}
+	}
+}
+
+func TestGitPseudoVersions(t *testing.T) {
+	f := newGitFixture(t)
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	commit1 := f.commit(map[string]string{"go.mod": "module example.com/m\n"}, start)
+	commit2 := f.commit(map[string]string{"a.go": "package m\n"}, start.Add(time.Hour))
+	commit3 := f.commit(map[string]string{"b.go": "package m\n"}, start.Add(2*time.Hour))
+	f.git(f.work, "checkout", "--quiet", "--orphan", "unrelated")
+	commit4 := f.commit(map[string]string{"go.mod": "module example.com/m\n", "c.go": "package m\n"}, start.Add(3*time.Hour))
+	f.tag("v1.0.0", commit1)
+	f.tag("v1.1.0-rc.1", commit2)
+
+	m, err := f.server("example.com/m").getGitModule("example.com/m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	t.Run("query", func(t *testing.T) {
+		tests := []struct {
+			query   string
+			version string
+			commit  string
+		}{
+			{"v1.0.0", "v1.0.0", commit1},
+			{commit1[:8], "v1.0.0", commit1},
+			{commit3, "v1.1.0-rc.1.0.20240102050405-" + commit3[:12], commit3},
+			{"main", "v1.1.0-rc.1.0.20240102050405-" + commit3[:12], commit3},
+			{"unrelated", "v0.0.0-20240102060405-" + commit4[:12], commit4},
+			{"nonexistent", "", ""},
+			{"v1.0.1", "", ""},
+		}
+		for _, test := range tests {
+			version, commit, err := m.query(ctx, test.query)
+			if test.version == "" {
+				if err == nil {
+					t.Errorf("query(%s) = %s, want error", test.query, version)
+				}
+			} else if err != nil {
+				t.Errorf("query(%s) failed: %s", test.query, err)
+			} else if version != test.version || commit != test.commit {
+				t.Errorf("query(%s) = %s %s, want %s %s", test.query, version, commit, test.version, test.commit)
+			}
+		}
+	})
+
+	t.Run("resolveVersion", func(t *testing.T) {
+		tests := []struct {
+			version string
+			commit  string // empty if the version is invalid
+		}{
+			{"v1.0.0", commit1},
+			{"v1.0.1-0.20240102040405-" + commit2[:12], commit2},
+			{"v1.1.0-rc.1.0.20240102050405-" + commit3[:12], commit3},
+			{"v1.0.1-0.20240102050405-" + commit3[:12], commit3},
+			{"v0.0.0-20240102050405-" + commit3[:12], commit3},
+			{"v0.0.0-20240102060405-" + commit4[:12], commit4},
+
+			// wrong commit time
+			{"v1.0.1-0.20240102050406-" + commit3[:12], ""},
+			// base version is not tagged
+			{"v1.0.6-0.20240102050405-" + commit3[:12], ""},
+			// base version is not an ancestor
+			{"v1.0.1-0.20240102060405-" + commit4[:12], ""},
+			// base version is the commit itself
+			{"v1.0.1-0.20240102030405-" + commit1[:12], ""},
+			// nonexistent commit
+			{"v1.0.1-0.20240102050405-abcdefabcdef", ""},
+			// non-canonical
+			{"v1.0", ""},
+			{"v1.0.0+build", ""},
+			// wrong major version
+			{"v2.0.0", ""},
+		}
+		for _, test := range tests {
+			commit, err := m.resolveVersion(ctx, test.version)
+			if test.commit == "" {
+				if err == nil {
+					t.Errorf("resolveVersion(%s) = %s, want error", test.version, commit)
+				}
+			} else if err != nil {
+				t.Errorf("resolveVersion(%s) failed: %s", test.version, err)
+			} else if commit != test.commit {
+				t.Errorf("resolveVersion(%s) = %s, want %s", test.version, commit, test.commit)
+			}
+		}
+	})
+
+	t.Run("latest", func(t *testing.T) {
+		version, commit, err := m.latest(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version != "v1.0.0" || commit != commit1 {
+			t.Errorf("latest = %s %s, want v1.0.0 %s", version, commit, commit1)
+		}
+	})
+}
+
+func TestGitGoMod(t *testing.T) {
+	f := newGitFixture(t)
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	commit1 := f.commit(map[string]string{"m.go": "package m\n"}, start)
+	commit2 := f.commit(map[string]string{"go.mod": "module example.com/m\n\ngo 1.21\n", "v2/go.mod": "module example.com/m/v2\n"}, start.Add(time.Hour))
+	commit3 := f.commit(map[string]string{"go.mod": "module example.com/other\n"}, start.Add(2*time.Hour))
+
+	s := f.server("example.com/m")
+	tests := []struct {
+		path   goproxy.ModulePath
+		commit string
+		want   string // empty if an error is expected
+	}{
+		{"example.com/m", commit1, "module example.com/m\n"},
+		{"example.com/m", commit2, "module example.com/m\n\ngo 1.21\n"},
+		{"example.com/m", commit3, ""},
+		{"example.com/m/v2", commit1, ""},
+		{"example.com/m/v2", commit2, "module example.com/m/v2\n"},
+		{"example.com/m/v3", commit2, ""},
+	}
+	for _, test := range tests {
+		m, err := s.getGitModule(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.repo.fetch(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		goMod, err := m.goMod(context.Background(), test.commit)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("goMod(%s, %s) = %q, want error", test.path, test.commit, goMod)
+			}
+		} else if err != nil {
+			t.Errorf("goMod(%s, %s) failed: %s", test.path, test.commit, err)
+		} else if string(goMod) != test.want {
+			t.Errorf("goMod(%s, %s) = %q, want %q", test.path, test.commit, goMod, test.want)
+		}
+	}
+}
+
+// TestGitZip checks that module zips have the same hash as zips created from the
+// repository by golang.org/x/mod/zip, which the go command uses
+func TestGitZip(t *testing.T) {
+	f := newGitFixture(t)
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	commit := f.commit(map[string]string{
+		"LICENSE":            "root license\n",
+		"go.mod":             "module example.com/m\n",
+		"m.go":               "package m\r\n",
+		"internal/x/x.go":    "package x\n",
+		"testdata/data.txt":  "data\n",
+		"ignored.txt":        "ignored\n",
+		".gitattributes":     "ignored.txt export-ignore\n",
+		"nested/go.mod":      "module example.com/m/nested\n",
+		"nested/nested.go":   "package nested\n",
+		"v2/go.mod":          "module example.com/m/v2\n",
+		"v2/m.go":            "package m\n",
+		"v2/vendor/x/x.go":   "package x\n",
+		"v2/sub/sub.go":      "package sub\n",
+		"v2/sub/LICENSE.txt": "sub license\n",
+	}, start)
+	f.tag("v1.0.0", commit)
+	f.tag("v2.0.0", commit)
+
+	s := f.server("example.com/m")
+	tests := []struct {
+		path    goproxy.ModulePath
+		version string
+		subdir  string
+	}{
+		{"example.com/m", "v1.0.0", ""},
+		{"example.com/m/v2", "v2.0.0", "v2"},
+	}
+	for _, test := range tests {
+		m, err := s.getGitModule(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.repo.fetch(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		content, err := m.zip(context.Background(), test.version, commit)
+		if err != nil {
+			t.Fatalf("zip(%s@%s) failed: %s", test.path, test.version, err)
+		}
+		gotFile := filepath.Join(t.TempDir(), "got.zip")
+		if err := os.WriteFile(gotFile, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		var want bytes.Buffer
+		if err := modzip.CreateFromVCS(&want, module.Version{Path: test.path.String(), Version: test.version}, f.work, commit, test.subdir); err != nil {
+			t.Fatal(err)
+		}
+		wantFile := filepath.Join(t.TempDir(), "want.zip")
+		if err := os.WriteFile(wantFile, want.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		gotHash, err := dirhash.HashZip(gotFile, dirhash.Hash1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantHash, err := dirhash.HashZip(wantFile, dirhash.Hash1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gotHash != wantHash {
+			t.Errorf("zip(%s@%s) has hash %s, want %s", test.path, test.version, gotHash, wantHash)
+		}
+	}
+}
@@ -44,6 +44,12 @@ func (version ModuleVersion) String() string {
 	return string(version)
 }
 
+// IsCanonical reports whether version is a canonical semantic version, as opposed to a query such as
+// a branch name.  Unlike semver.Canonical, this preserves the +incompatible suffix.
+func (version ModuleVersion) IsCanonical() bool {
+	return module.CanonicalVersion(string(version)) == string(version)
+}
+
 func (version ModuleVersion) Escaped() string {
 	escaped, err := module.EscapeVersion(string(version))
 	if err != nil {
@@ -0,0 +1,79 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// checkHash returns an error unless str is a hash in go.sum form (h1:BASE64)
+func checkHash(str string) error {
+	encoded, ok := strings.CutPrefix(str, "h1:")
+	if !ok {
+		return fmt.Errorf("hash %q does not start with h1:", str)
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(encoded); err != nil || len(decoded) != sha256.Size {
+		return fmt.Errorf("hash %q is malformed", str)
+	}
+	return nil
+}
+
+func hashZip(zipReader *zip.Reader) (string, error) {
+	filenames := make([]string, 0, len(zipReader.File))
+	files := make(map[string]*zip.File, len(zipReader.File))
+	for _, file := range zipReader.File {
+		if _, exists := files[file.Name]; exists {
+			return "", fmt.Errorf("zip file contains duplicate file %q", file.Name)
+		}
+		filenames = append(filenames, file.Name)
+		files[file.Name] = file
+	}
+	return dirhash.Hash1(filenames, func(name string) (io.ReadCloser, error) {
+		return files[name].Open()
+	})
+}
+
+func hashZipBytes(zipBytes []byte) (string, error) {
+	zipReader, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	if err != nil {
+		return "", fmt.Errorf("error reading module zip file: %w", err)
+	}
+	return hashZip(zipReader)
+}
+
+func hashGoMod(goMod []byte) (string, error) {
+	return dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(goMod)), nil
+	})
+}
@@ -0,0 +1,222 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/mod/sumdb/dirhash"
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+const testHash = "h1:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+
+func TestCheckHash(t *testing.T) {
+	tests := []struct {
+		hash    string
+		wantErr bool
+	}{
+		{testHash, false},
+		{"47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=", true},
+		{"h2:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=", true},
+		{"h1:", true},
+		{"h1:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU", true},
+		{"h1:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NM=", true},
+		{"h1:!!!!", true},
+	}
+	for _, test := range tests {
+		if err := checkHash(test.hash); (err != nil) != test.wantErr {
+			t.Errorf("checkHash(%q) = %v, want error = %v", test.hash, err, test.wantErr)
+		}
+	}
+}
+
+func makeTestZip(t *testing.T, files ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zipWriter := zip.NewWriter(&buf)
+	for _, name := range files {
+		w, err := zipWriter.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("contents of " + name + "\n"))
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestHashZipBytes(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		wantErr bool
+	}{
+		{"single", []string{"example.com/m@v1.0.0/go.mod"}, false},
+		{"multiple", []string{"example.com/m@v1.0.0/go.mod", "example.com/m@v1.0.0/m.go", "example.com/m@v1.0.0/LICENSE"}, false},
+		{"duplicate", []string{"example.com/m@v1.0.0/m.go", "example.com/m@v1.0.0/m.go"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			zipBytes := makeTestZip(t, test.files...)
+			hash, err := hashZipBytes(zipBytes)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("hashZipBytes succeeded, want error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			zipFile := filepath.Join(t.TempDir(), "m.zip")
+			if err := os.WriteFile(zipFile, zipBytes, 0666); err != nil {
+				t.Fatal(err)
+			}
+			want, err := dirhash.HashZip(zipFile, dirhash.Hash1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hash != want {
+				t.Errorf("hashZipBytes = %s, want %s", hash, want)
+			}
+		})
+	}
+	if _, err := hashZipBytes([]byte("not a zip file")); err == nil {
+		t.Errorf("hashZipBytes succeeded on malformed zip file")
+	}
+}
+
+func TestHashGoMod(t *testing.T) {
+	goMod := []byte("module example.com/m\n")
+	want, err := dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(goMod)), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash, err := hashGoMod(goMod); err != nil {
+		t.Fatal(err)
+	} else if hash != want {
+		t.Errorf("hashGoMod = %s, want %s", hash, want)
+	}
+	if hash, _ := hashGoMod([]byte("module example.com/other\n")); hash == want {
+		t.Errorf("hashGoMod returned the same hash for different go.mod files")
+	}
+}
+
+func TestPinnedHashes(t *testing.T) {
+	const (
+		zipHash   = "h1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+		goModHash = "h1:BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBA="
+	)
+	allowlist := compileTestAllowlist(t, `
+example.com/a v1.0.0 `+zipHash+`
+example.com/a v1.0.0/go.mod `+goModHash+`
+example.com/a v1.1.0
+example.com/b v1.0.0/go.mod `+goModHash+`
+example.com/c *
+example.com/c >=v1.0.0
+`)
+	tests := []struct {
+		path          goproxy.ModulePath
+		version       goproxy.ModuleVersion
+		wantZipHash   string
+		wantGoModHash string
+	}{
+		{"example.com/a", "v1.0.0", zipHash, goModHash},
+		{"example.com/a", "v1.1.0", "", ""},
+		{"example.com/a", "v1.2.0", "", ""},
+		{"example.com/b", "v1.0.0", "", goModHash},
+		{"example.com/c", "v1.0.0", "", ""},
+		{"example.com/d", "v1.0.0", "", ""},
+	}
+	for _, test := range tests {
+		zipHash, goModHash := allowlist.pinnedHashes(test.path, test.version)
+		if zipHash != test.wantZipHash || goModHash != test.wantGoModHash {
+			t.Errorf("pinnedHashes(%s, %s) = %q, %q; want %q, %q", test.path, test.version, zipHash, goModHash, test.wantZipHash, test.wantGoModHash)
+		}
+	}
+}
+
+func TestServePinnedHash(t *testing.T) {
+	goMod := []byte("module example.com/m\n")
+	zipBytes := makeTestZip(t, "example.com/m@v1.0.0/go.mod", "example.com/m@v1.0.0/m.go")
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case strings.HasSuffix(req.URL.Path, ".mod"):
+			w.Write(goMod)
+		case strings.HasSuffix(req.URL.Path, ".zip"):
+			w.Write(zipBytes)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer upstream.Close()
+
+	goModHash, err := hashGoMod(goMod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipHash, err := hashZipBytes(zipBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, upstream.URL, `
+example.com/m v1.0.0 `+zipHash+`
+example.com/m v1.0.0/go.mod `+goModHash+`
+example.com/m v1.1.0 `+testHash+`
+example.com/m v1.1.0/go.mod `+testHash+`
+example.com/m v1.2.0
+`)
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{"/proxy/example.com/m/@v/v1.0.0.mod", http.StatusOK},
+		{"/proxy/example.com/m/@v/v1.0.0.zip", http.StatusOK},
+		{"/proxy/example.com/m/@v/v1.1.0.mod", http.StatusBadGateway},
+		{"/proxy/example.com/m/@v/v1.1.0.zip", http.StatusBadGateway},
+		{"/proxy/example.com/m/@v/v1.2.0.mod", http.StatusSeeOther},
+		{"/proxy/example.com/m/@v/v1.2.0.zip", http.StatusSeeOther},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		s.HTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if rec.Code != test.wantStatus {
+			t.Errorf("GET %s returned status %d, want %d", test.path, rec.Code, test.wantStatus)
+		}
+	}
+}
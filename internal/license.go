@@ -0,0 +1,262 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode"
+
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+// Special SPDX identifiers used when a module has no license file, or has a license file
+// that could not be classified
+const (
+	LicenseNone        = "NONE"
+	LicenseNoAssertion = "NOASSERTION"
+)
+
+const (
+	// Minimum fraction of a license excerpt's shingles which must appear in a license file
+	licenseMatchThreshold = 0.8
+
+	// When several templates match a file, a template which matches more shingles is
+	// preferred over one with greater coverage if it matches at least this many more.
+	// This distinguishes licenses which extend other licenses, like BSD-3-Clause and BSD-2-Clause.
+	licenseExtensionMargin = 10
+
+	// Maximum size of a license file that will be classified
+	maxLicenseFileSize = 1 << 20
+
+	// Maximum number of module versions whose licenses are remembered; when exceeded,
+	// arbitrary entries are forgotten
+	maxLicenses = 10000
+)
+
+// Each file in licenseexcerpts is an excerpt of the license named by the file's SPDX identifier,
+// not the full license text.  A license file matches if it contains most of an excerpt, so an
+// excerpt only needs to be long enough to be distinctive.  The excerpts of short licenses, like
+// MIT, contain the complete terms of the license.  The excerpts of long licenses contain the
+// beginning of the license, which includes the title, version, and preamble that distinguish
+// licenses which share most of their text, like GPL-3.0 and AGPL-3.0.
+//
+//go:embed licenseexcerpts/*.txt
+var licenseExcerpts embed.FS
+
+// A licenseTemplate is the set of shingles (see makeShingles) of a license excerpt
+type licenseTemplate struct {
+	id       string // SPDX identifier
+	shingles map[string]struct{}
+}
+
+var licenseTemplates = loadLicenseTemplates()
+
+func loadLicenseTemplates() []licenseTemplate {
+	entries, err := licenseExcerpts.ReadDir("licenseexcerpts")
+	if err != nil {
+		panic(err)
+	}
+	templates := make([]licenseTemplate, 0, len(entries))
+	for _, entry := range entries {
+		text, err := licenseExcerpts.ReadFile("licenseexcerpts/" + entry.Name())
+		if err != nil {
+			panic(err)
+		}
+		templates = append(templates, licenseTemplate{
+			id:       strings.TrimSuffix(entry.Name(), ".txt"),
+			shingles: makeShingles(string(text)),
+		})
+	}
+	return templates
+}
+
+// makeShingles returns the set of three-word sequences in the text, after normalizing
+// case and removing punctuation, so that formatting differences don't affect matching
+func makeShingles(text string) map[string]struct{} {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	shingles := make(map[string]struct{})
+	for i := 0; i+3 <= len(words); i++ {
+		shingles[strings.Join(words[i:i+3], " ")] = struct{}{}
+	}
+	return shingles
+}
+
+// classifyLicense returns the SPDX identifier of the license in text, or LicenseNoAssertion
+// if it doesn't match any known license
+func classifyLicense(text string) string {
+	shingles := makeShingles(text)
+
+	type candidate struct {
+		id       string
+		matched  int
+		coverage float64
+	}
+	var candidates []candidate
+	for _, template := range licenseTemplates {
+		matched := 0
+		for shingle := range template.shingles {
+			if _, ok := shingles[shingle]; ok {
+				matched++
+			}
+		}
+		coverage := float64(matched) / float64(len(template.shingles))
+		if coverage >= licenseMatchThreshold {
+			candidates = append(candidates, candidate{id: template.id, matched: matched, coverage: coverage})
+		}
+	}
+	if len(candidates) == 0 {
+		return LicenseNoAssertion
+	}
+
+	mostMatched := slices.MaxFunc(candidates, func(a, b candidate) int { return a.matched - b.matched }).matched
+	var best *candidate
+	for i := range candidates {
+		if candidates[i].matched >= mostMatched-licenseExtensionMargin && (best == nil || candidates[i].coverage > best.coverage) {
+			best = &candidates[i]
+		}
+	}
+	return best.id
+}
+
+// isLicenseFile reports whether the file with the given name in a module zip file is a license
+// file in the root directory of the module.  License files in subdirectories are ignored, since
+// they usually apply only to third-party code in those subdirectories.
+func isLicenseFile(name string) bool {
+	_, name, _ = strings.Cut(name, "@") // remove the module path
+	_, name, _ = strings.Cut(name, "/") // remove the version
+	if strings.Contains(name, "/") {
+		return false
+	}
+	name = strings.ToUpper(name)
+	return strings.HasPrefix(name, "LICENSE") || strings.HasPrefix(name, "LICENCE") || strings.HasPrefix(name, "COPYING") || strings.HasPrefix(name, "UNLICENSE")
+}
+
+// detectLicenses returns the sorted, de-duplicated SPDX identifiers of the licenses found
+// in the license files in the root of the module zip file, or LicenseNone if there are no license files
+func detectLicenses(zipReader *zip.Reader) ([]string, error) {
+	var licenses []string
+	for _, file := range zipReader.File {
+		if !isLicenseFile(file.Name) || file.FileInfo().IsDir() {
+			continue
+		}
+		r, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("error opening %s: %w", file.Name, err)
+		}
+		text, err := io.ReadAll(io.LimitReader(r, maxLicenseFileSize))
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", file.Name, err)
+		}
+		licenses = append(licenses, classifyLicense(string(text)))
+	}
+	if len(licenses) == 0 {
+		return []string{LicenseNone}, nil
+	}
+	slices.Sort(licenses)
+	return slices.Compact(licenses), nil
+}
+
+// getModuleLicenses returns the licenses detected in the given module version.  The zip file is
+// fetched and verified the same way as when it is served (see fetchVerifiedFile), so the licenses
+// are those of the zip file that clients receive.  Since module versions are immutable, the
+// result is cached.
+func (s *Server) getModuleLicenses(ctx context.Context, module goproxy.ModulePath, version goproxy.ModuleVersion) ([]string, error) {
+	key := module.String() + "@" + version.String()
+	if licenses, ok := s.loadLicenses(key); ok {
+		return licenses, nil
+	}
+	zipBytes, err := s.fetchVerifiedFile(ctx, module, goproxy.ZipRequest{Version: version})
+	if err != nil {
+		return nil, err
+	}
+	zipReader, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	if err != nil {
+		return nil, fmt.Errorf("error reading module zip file: %w", err)
+	}
+	licenses, err := detectLicenses(zipReader)
+	if err != nil {
+		return nil, err
+	}
+	s.storeLicenses(key, licenses)
+	return licenses, nil
+}
+
+func (s *Server) loadLicenses(key string) ([]string, bool) {
+	s.licensesMu.Lock()
+	defer s.licensesMu.Unlock()
+	licenses, ok := s.licenses[key]
+	return licenses, ok
+}
+
+func (s *Server) storeLicenses(key string, licenses []string) {
+	s.licensesMu.Lock()
+	defer s.licensesMu.Unlock()
+	if s.licenses == nil {
+		s.licenses = make(map[string][]string)
+	}
+	if len(s.licenses) >= maxLicenses {
+		// Forget arbitrary entries; forgotten licenses are detected again when needed
+		for key := range s.licenses {
+			if len(s.licenses) <= maxLicenses*9/10 {
+				break
+			}
+			delete(s.licenses, key)
+		}
+	}
+	s.licenses[key] = licenses
+}
+
+// A LicensePolicy specifies which licenses modules may use, by SPDX identifier.
+// LicenseNone and LicenseNoAssertion may be used to allow or deny modules without
+// a license file or with an unrecognized license.
+type LicensePolicy struct {
+	Allowed []string // if non-empty, every license of a module must be in this list
+	Denied  []string // no license of a module may be in this list
+}
+
+// check returns the first of the given licenses which is not allowed by the policy,
+// or the empty string if every license is allowed
+func (policy *LicensePolicy) check(licenses []string) string {
+	for _, license := range licenses {
+		if slices.Contains(policy.Denied, license) {
+			return license
+		}
+		if len(policy.Allowed) > 0 && !slices.Contains(policy.Allowed, license) {
+			return license
+		}
+	}
+	return ""
+}
@@ -0,0 +1,273 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// The files in testdata/licenses are real license files, from Debian's
+// /usr/share/common-licenses and from the LICENSE files of various projects
+func TestClassifyLicenseFiles(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"apache-2.0", "Apache-2.0"},
+		{"bsd-regents", "BSD-3-Clause"},
+		{"cc0-1.0", LicenseNoAssertion},
+		{"go-junit-report", "MIT"},
+		{"golang-x-mod", "BSD-3-Clause"},
+		{"gpl-2", "GPL-2.0"},
+		{"gpl-3", "GPL-3.0"},
+		{"lgpl-2.1", "LGPL-2.1"},
+		{"lgpl-3", "LGPL-3.0"},
+		{"libsodium", "ISC"},
+		{"mpl-2.0", "MPL-2.0"},
+		{"packaging-bsd", "BSD-2-Clause"},
+		{"zlib", "Zlib"},
+	}
+	for _, test := range tests {
+		text, err := os.ReadFile(filepath.Join("testdata", "licenses", test.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := classifyLicense(string(text)); got != test.want {
+			t.Errorf("classifyLicense(%s) = %s, want %s", test.file, got, test.want)
+		}
+	}
+}
+
+func TestClassifyLicense(t *testing.T) {
+	gpl3, err := os.ReadFile(filepath.Join("testdata", "licenses", "gpl-3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mit, err := os.ReadFile(filepath.Join("testdata", "licenses", "go-junit-report"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"empty", "", LicenseNoAssertion},
+		{"not a license", "This project is great.  See the documentation for details.\n", LicenseNoAssertion},
+		{"reformatted", strings.ToUpper(strings.Join(strings.Fields(string(mit)), "\n")), "MIT"},
+		{"with a comment prefix", "// " + strings.ReplaceAll(string(mit), "\n", "\n// "), "MIT"},
+		{"first half", string(mit[:len(mit)/2]), LicenseNoAssertion},
+		{"GPL-3.0 with a notice", "This program is licensed under the GPL.\n\n" + string(gpl3), "GPL-3.0"},
+	}
+	for _, test := range tests {
+		if got := classifyLicense(test.text); got != test.want {
+			t.Errorf("classifyLicense(%s) = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestIsLicenseFile(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"example.com/m@v1.0.0/LICENSE", true},
+		{"example.com/m@v1.0.0/LICENSE.md", true},
+		{"example.com/m@v1.0.0/license.txt", true},
+		{"example.com/m@v1.0.0/LICENCE", true},
+		{"example.com/m@v1.0.0/COPYING.LESSER", true},
+		{"example.com/m@v1.0.0/UNLICENSE", true},
+		{"example.com/m/v2@v2.0.0/LICENSE", true},
+		{"example.com/m@v1.0.0/README.md", false},
+		{"example.com/m@v1.0.0/vendor/example.org/x/LICENSE", false},
+		{"example.com/m@v1.0.0/third_party/LICENSE", false},
+		{"example.com/license@v1.0.0/main.go", false},
+	}
+	for _, test := range tests {
+		if got := isLicenseFile(test.name); got != test.want {
+			t.Errorf("isLicenseFile(%q) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDetectLicenses(t *testing.T) {
+	readLicense := func(file string) string {
+		text, err := os.ReadFile(filepath.Join("testdata", "licenses", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(text)
+	}
+	tests := []struct {
+		files map[string]string
+		want  string
+	}{
+		{map[string]string{"go.mod": "module example.com/m\n"}, "NONE"},
+		{map[string]string{"LICENSE": readLicense("golang-x-mod")}, "BSD-3-Clause"},
+		{map[string]string{"COPYING": readLicense("gpl-3"), "COPYING.LESSER": readLicense("lgpl-3")}, "GPL-3.0,LGPL-3.0"},
+		{map[string]string{"LICENSE": readLicense("go-junit-report"), "vendor/example.org/x/LICENSE": readLicense("gpl-2")}, "MIT"},
+		{map[string]string{"LICENSE": "All rights reserved.\n", "LICENSE.md": readLicense("go-junit-report")}, "MIT,NOASSERTION"},
+		{map[string]string{"third_party/LICENSE": readLicense("gpl-2")}, "NONE"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		zipWriter := zip.NewWriter(&buf)
+		for name, content := range test.files {
+			w, err := zipWriter.Create("example.com/m@v1.0.0/" + name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write([]byte(content))
+		}
+		if err := zipWriter.Close(); err != nil {
+			t.Fatal(err)
+		}
+		zipReader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		licenses, err := detectLicenses(zipReader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(licenses, ","); got != test.want {
+			t.Errorf("detectLicenses of files %v = %s, want %s", slices.Sorted(maps.Keys(test.files)), got, test.want)
+		}
+	}
+}
+
+// newTestZipUpstream returns an upstream proxy which serves zipContent as the zip file of every
+// module version, and counts the zip files it serves
+func newTestZipUpstream(t *testing.T, zipContent []byte) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	zipRequests := new(atomic.Int32)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasSuffix(req.URL.Path, ".zip") {
+			zipRequests.Add(1)
+			w.Write(zipContent)
+		} else if strings.HasSuffix(req.URL.Path, "/@latest") {
+			io.WriteString(w, `{"Version":"v1.0.0","Time":"2020-01-01T00:00:00Z"}`)
+		} else if _, file, ok := strings.Cut(req.URL.Path, "/@v/"); ok && strings.HasSuffix(file, ".info") {
+			io.WriteString(w, `{"Version":"`+strings.TrimSuffix(file, ".info")+`","Time":"2020-01-01T00:00:00Z"}`)
+		} else {
+			http.NotFound(w, req)
+		}
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream, zipRequests
+}
+
+func TestGetModuleLicenses(t *testing.T) {
+	zipContent := makeTestZip(t, "example.com/m@v1.0.0/go.mod", "example.com/m@v1.0.0/LICENSE")
+	zipHash, err := hashZipBytes(zipContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		allowlist string
+		wantErr   bool
+	}{
+		{"example.com/m v1.0.0\n", false},
+		{"example.com/m v1.0.0 " + zipHash + "\n", false},
+		{"example.com/m v1.0.0 " + testHash + "\n", true}, // the upstream's zip file doesn't match the pinned hash
+	}
+	for _, test := range tests {
+		upstream, zipRequests := newTestZipUpstream(t, zipContent)
+		s := newTestServer(t, upstream.URL, test.allowlist)
+		for i := 0; i < 2; i++ {
+			licenses, err := s.getModuleLicenses(context.Background(), "example.com/m", "v1.0.0")
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("%q: getModuleLicenses succeeded, want error", test.allowlist)
+				}
+			} else if err != nil {
+				t.Errorf("%q: getModuleLicenses failed: %s", test.allowlist, err)
+			} else if got := strings.Join(licenses, ","); got != LicenseNoAssertion {
+				t.Errorf("%q: getModuleLicenses = %s, want %s", test.allowlist, got, LicenseNoAssertion)
+			}
+		}
+		wantRequests := int32(1) // the result is cached
+		if test.wantErr {
+			wantRequests = 2
+		}
+		if n := zipRequests.Load(); n != wantRequests {
+			t.Errorf("%q: upstream served %d zip files, want %d", test.allowlist, n, wantRequests)
+		}
+	}
+}
+
+func TestStoreLicensesBounded(t *testing.T) {
+	var s Server
+	for i := 0; i <= maxLicenses; i++ {
+		s.storeLicenses(fmt.Sprintf("example.com/m@v1.0.%d", i), []string{"MIT"})
+	}
+	if n := len(s.licenses); n > maxLicenses {
+		t.Errorf("%d licenses remembered, want at most %d", n, maxLicenses)
+	}
+	if licenses, ok := s.loadLicenses(fmt.Sprintf("example.com/m@v1.0.%d", maxLicenses)); !ok || !slices.Equal(licenses, []string{"MIT"}) {
+		t.Errorf("most recently stored licenses = %v, %v", licenses, ok)
+	}
+}
+
+func TestDashboardLicenses(t *testing.T) {
+	zipContent := makeTestZip(t, "example.com/m@v1.0.0/go.mod", "example.com/m@v1.0.0/LICENSE")
+	tests := []struct {
+		policy       *LicensePolicy
+		wantRequests int32
+		wantLicense  bool
+	}{
+		{nil, 0, false},
+		{&LicensePolicy{Denied: []string{"GPL-3.0"}}, 2, true},
+	}
+	for _, test := range tests {
+		upstream, zipRequests := newTestZipUpstream(t, zipContent)
+		s := newTestServer(t, upstream.URL, "example.com/m v1.0.0\nexample.com/other *\n")
+		s.LicensePolicy = test.policy
+		rec := serveTestRequest(s, "/")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("dashboard returned %d %q", rec.Code, rec.Body.String())
+		}
+		if n := zipRequests.Load(); n != test.wantRequests {
+			t.Errorf("policy %v: dashboard downloaded %d zip files, want %d", test.policy, n, test.wantRequests)
+		}
+		if got := strings.Contains(rec.Body.String(), LicenseNoAssertion); got != test.wantLicense {
+			t.Errorf("policy %v: dashboard shows license = %v, want %v", test.policy, got, test.wantLicense)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/mod/module"
+
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+// isLocalUpstream reports whether the upstream proxy URL refers to a directory on the local filesystem
+// (a file:// URL) in the layout of $GOMODCACHE/cache/download.  Since clients can't be redirected
+// to such a proxy, files from it are always served directly.
+func isLocalUpstream(upstreamURL *url.URL) bool {
+	return upstreamURL.Scheme == "file"
+}
+
+func localUpstreamPath(dir string, module goproxy.ModulePath, req goproxy.Request) string {
+	return filepath.Join(filepath.FromSlash(dir), filepath.FromSlash(module.Escaped()), filepath.FromSlash(req.Path()))
+}
+
+// listLocalUpstream returns the versions of the module in the local upstream directory: those
+// in the @v/list file written by the go command, plus any others with a .zip file.  Versions
+// with only a .info or .mod file are not listed, since the go command writes those for versions
+// it resolved but never downloaded.  Like the list of any proxy, the list excludes pseudo-versions.
+func listLocalUpstream(upstreamDir string, path goproxy.ModulePath) ([]goproxy.ModuleVersion, error) {
+	dir := filepath.Dir(localUpstreamPath(upstreamDir, path, goproxy.ListRequest{}))
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	versions := []goproxy.ModuleVersion{}
+	add := func(version goproxy.ModuleVersion) {
+		if !module.IsPseudoVersion(version.String()) && !slices.Contains(versions, version) {
+			versions = append(versions, version)
+		}
+	}
+	if list, err := os.ReadFile(filepath.Join(dir, "list")); err == nil {
+		for _, line := range strings.Fields(string(list)) {
+			if version, err := goproxy.MakeModuleVersion(line); err == nil {
+				add(version)
+			}
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		escaped, isZip := strings.CutSuffix(entry.Name(), ".zip")
+		if !isZip {
+			continue
+		}
+		if version, err := goproxy.UnescapeModuleVersion(escaped); err == nil {
+			add(version)
+		}
+	}
+	return versions, nil
+}
+
+// openLocalUpstream opens the file for req in the local upstream directory dir.  Since the go command
+// doesn't store @latest responses, LatestRequest is answered with the .info file of the
+// latest version in the list.
+func openLocalUpstream(dir string, module goproxy.ModulePath, req goproxy.Request) (io.ReadCloser, error) {
+	switch req.(type) {
+	case goproxy.ListRequest:
+		versions, err := listLocalUpstream(dir, module)
+		if err != nil {
+			return nil, err
+		}
+		var list strings.Builder
+		for _, version := range versions {
+			list.WriteString(version.String() + "\n")
+		}
+		return io.NopCloser(strings.NewReader(list.String())), nil
+	case goproxy.LatestRequest:
+		versions, err := listLocalUpstream(dir, module)
+		if err != nil {
+			return nil, err
+		}
+		latest := latestVersion(versions)
+		if latest.IsEmpty() {
+			return nil, errNotFound
+		}
+		req = goproxy.InfoRequest{Version: latest}
+	}
+
+	file, err := os.Open(localUpstreamPath(dir, module, req))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
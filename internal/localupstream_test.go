@@ -0,0 +1,150 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+// newTestLocalUpstream returns a directory in the layout of $GOMODCACHE/cache/download
+func newTestLocalUpstream(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"github.com/!burnt!sushi/toml/@v/list":                                      "v1.0.0\nv1.1.0\n",
+		"github.com/!burnt!sushi/toml/@v/v1.0.0.info":                               `{"Version":"v1.0.0","Time":"2020-01-01T00:00:00Z"}`,
+		"github.com/!burnt!sushi/toml/@v/v1.0.0.mod":                                "module github.com/BurntSushi/toml\n",
+		"github.com/!burnt!sushi/toml/@v/v1.1.0.info":                               `{"Version":"v1.1.0","Time":"2021-01-01T00:00:00Z"}`,
+		"github.com/!burnt!sushi/toml/@v/v1.2.0.info":                               `{"Version":"v1.2.0","Time":"2022-01-01T00:00:00Z"}`,
+		"github.com/!burnt!sushi/toml/@v/v1.2.0.zip":                                "zip",
+		"github.com/!burnt!sushi/toml/@v/v1.3.0-rc.1.info":                          `{"Version":"v1.3.0-rc.1","Time":"2023-01-01T00:00:00Z"}`, // resolved but not downloaded
+		"github.com/!burnt!sushi/toml/@v/v1.3.0-rc.1.mod":                           "module github.com/BurntSushi/toml\n",
+		"github.com/!burnt!sushi/toml/@v/v1.4.0-0.20240101000000-abcdefabcdef.info": `{"Version":"v1.4.0-0.20240101000000-abcdefabcdef","Time":"2024-01-01T00:00:00Z"}`,
+		"github.com/!burnt!sushi/toml/@v/v1.4.0-0.20240101000000-abcdefabcdef.zip":  "zip",
+		"example.com/nolist/@v/v0.1.0.info":                                         `{"Version":"v0.1.0","Time":"2020-01-01T00:00:00Z"}`,
+		"example.com/nolist/@v/v0.1.0.zip":                                          "zip",
+		"example.com/nolist/@v/v0.2.0.info":                                         `{"Version":"v0.2.0","Time":"2021-01-01T00:00:00Z"}`,
+		"example.com/empty/@v/v0.1.0.lock":                                          "",
+	}
+	for name, content := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestListLocalUpstream(t *testing.T) {
+	dir := newTestLocalUpstream(t)
+	tests := []struct {
+		module  goproxy.ModulePath
+		want    []goproxy.ModuleVersion
+		wantErr error
+	}{
+		{"github.com/BurntSushi/toml", []goproxy.ModuleVersion{"v1.0.0", "v1.1.0", "v1.2.0"}, nil},
+		{"example.com/nolist", []goproxy.ModuleVersion{"v0.1.0"}, nil},
+		{"example.com/empty", []goproxy.ModuleVersion{}, nil},
+		{"example.com/missing", nil, errNotFound},
+	}
+	for _, test := range tests {
+		got, err := listLocalUpstream(dir, test.module)
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("listLocalUpstream(%s) returned error %v, want %v", test.module, err, test.wantErr)
+		}
+		slices.SortFunc(got, goproxy.ModuleVersion.Compare)
+		if !slices.Equal(got, test.want) {
+			t.Errorf("listLocalUpstream(%s) = %v, want %v", test.module, got, test.want)
+		}
+	}
+}
+
+func TestOpenLocalUpstream(t *testing.T) {
+	dir := newTestLocalUpstream(t)
+	tests := []struct {
+		module  goproxy.ModulePath
+		req     goproxy.Request
+		want    string
+		wantErr error
+	}{
+		{"github.com/BurntSushi/toml", goproxy.ModRequest{Version: "v1.0.0"}, "module github.com/BurntSushi/toml\n", nil},
+		{"github.com/BurntSushi/toml", goproxy.LatestRequest{}, `{"Version":"v1.2.0","Time":"2022-01-01T00:00:00Z"}`, nil},
+		{"github.com/BurntSushi/toml", goproxy.ModRequest{Version: "v1.1.0"}, "", errNotFound},
+		{"github.com/BurntSushi/toml", goproxy.ZipRequest{Version: "v1.0.0"}, "", errNotFound},
+		{"example.com/empty", goproxy.LatestRequest{}, "", errNotFound},
+		{"example.com/missing", goproxy.InfoRequest{Version: "v1.0.0"}, "", errNotFound},
+	}
+	for _, test := range tests {
+		body, err := openLocalUpstream(dir, test.module, test.req)
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("openLocalUpstream(%s, %s) returned error %v, want %v", test.module, test.req.Path(), err, test.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		content, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != test.want {
+			t.Errorf("openLocalUpstream(%s, %s) = %q, want %q", test.module, test.req.Path(), content, test.want)
+		}
+	}
+}
+
+func TestServeLocalUpstream(t *testing.T) {
+	dir := newTestLocalUpstream(t)
+	s := newTestServer(t, (&url.URL{Scheme: "file", Path: filepath.ToSlash(dir)}).String(), "github.com/BurntSushi/toml *\n")
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"/proxy/github.com/!burnt!sushi/toml/@v/v1.0.0.mod", http.StatusOK, "module github.com/BurntSushi/toml\n"},
+		{"/proxy/github.com/!burnt!sushi/toml/@latest", http.StatusOK, `{"Version":"v1.2.0","Time":"2022-01-01T00:00:00Z"}`},
+		{"/proxy/github.com/!burnt!sushi/toml/@v/list", http.StatusOK, "v1.0.0\nv1.1.0\nv1.2.0\n"},
+		{"/proxy/github.com/!burnt!sushi/toml/@v/v1.0.0.zip", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		rec := serveTestRequest(s, test.path)
+		if rec.Code != test.wantStatus || (test.wantBody != "" && rec.Body.String() != test.wantBody) {
+			t.Errorf("GET %s returned %d %q, want %d %q", test.path, rec.Code, rec.Body.String(), test.wantStatus, test.wantBody)
+		}
+	}
+}
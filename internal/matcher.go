@@ -0,0 +1,287 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"strings"
+	"time"
+
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+// A versionSet is the set of versions matched by a group of allowlist entries
+type versionSet struct {
+	all         bool
+	versions    map[goproxy.ModuleVersion]bool
+	constraints []*VersionConstraint
+}
+
+func (set *versionSet) add(m *AllowedModule) {
+	if m.Version.IsSet() {
+		if set.versions == nil {
+			set.versions = make(map[goproxy.ModuleVersion]bool)
+		}
+		set.versions[m.Version] = true
+	} else if m.VersionConstraint != nil {
+		set.constraints = append(set.constraints, m.VersionConstraint)
+	} else {
+		set.all = true
+	}
+}
+
+func (set *versionSet) isEmpty() bool {
+	return !set.all && len(set.versions) == 0 && len(set.constraints) == 0
+}
+
+func (set *versionSet) contains(version goproxy.ModuleVersion) bool {
+	if set.all || set.versions[version] {
+		return true
+	}
+	for _, constraint := range set.constraints {
+		if constraint.Matches(version) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *AllowedModule) matchesVersion(version goproxy.ModuleVersion) bool {
+	if m.Version.IsSet() {
+		return m.Version == version
+	} else if m.VersionConstraint != nil {
+		return m.VersionConstraint.Matches(version)
+	} else {
+		return true
+	}
+}
+
+// pathRules holds every allowlist entry that matches a particular module path
+type pathRules struct {
+	entries []*AllowedModule
+	allow   versionSet
+	deny    versionSet
+	pinned  []goproxy.ModuleVersion // versions allowed by entries with an exact path and version
+}
+
+func (rules *pathRules) add(m *AllowedModule) {
+	rules.entries = append(rules.entries, m)
+	if m.Deny {
+		rules.deny.add(m)
+	} else {
+		rules.allow.add(m)
+		if m.Path.IsSet() && m.Version.IsSet() {
+			rules.pinned = append(rules.pinned, m.Version)
+		}
+	}
+}
+
+func (rules *pathRules) isAllowed(version goproxy.ModuleVersion) bool {
+	return rules.allow.contains(version) && !rules.deny.contains(version)
+}
+
+// decidingEntry returns the first line of the allowlist which decides whether the given version
+// is allowed: a deny entry matching the version if there is one, or else an allow entry matching
+// it.  If version is empty, only entries matching every version are considered.  If no entry
+// decides, nil is returned.
+func (rules *pathRules) decidingEntry(version goproxy.ModuleVersion) *AllowedModule {
+	var allow, deny *AllowedModule
+	for _, m := range rules.entries {
+		if version.IsEmpty() && (m.Version.IsSet() || m.VersionConstraint != nil) {
+			continue
+		} else if version.IsSet() && !m.matchesVersion(version) {
+			continue
+		}
+		if m.Deny {
+			if deny == nil || m.Line < deny.Line {
+				deny = m
+			}
+		} else if allow == nil || m.Line < allow.Line {
+			allow = m
+		}
+	}
+	if deny != nil {
+		return deny
+	}
+	return allow
+}
+
+// minAge returns the minimum age of the given version before it is allowed.  If any
+// allow entry which matches the version specifies a minimum age, the smallest such age is
+// returned.  Otherwise, defaultMinAge is returned.
+func (rules *pathRules) minAge(version goproxy.ModuleVersion, defaultMinAge time.Duration) time.Duration {
+	var minAge *time.Duration
+	for _, m := range rules.entries {
+		if !m.Deny && m.MinAge != nil && m.matchesVersion(version) && (minAge == nil || *m.MinAge < *minAge) {
+			minAge = m.MinAge
+		}
+	}
+	if minAge == nil {
+		return defaultMinAge
+	}
+	return *minAge
+}
+
+// hasMinAge reports whether a minimum age may apply to any version
+func (rules *pathRules) hasMinAge(defaultMinAge time.Duration) bool {
+	if defaultMinAge > 0 {
+		return true
+	}
+	for _, m := range rules.entries {
+		if !m.Deny && m.MinAge != nil && *m.MinAge > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// patternNode is a node in a trie keyed by the literal leading elements of
+// module path patterns.  Each pattern is stored at the node for its longest
+// literal prefix, so only patterns at nodes along a module path need to be
+// evaluated when matching the path.
+type patternNode struct {
+	children map[string]*patternNode
+	patterns []*AllowedModule
+}
+
+func isLiteralPathElement(element string) bool {
+	return element != "..." && !strings.ContainsAny(element, "*?[\\")
+}
+
+func (node *patternNode) insert(m *AllowedModule) {
+	for _, element := range strings.Split(m.PathPattern, "/") {
+		if !isLiteralPathElement(element) {
+			break
+		}
+		if node.children == nil {
+			node.children = make(map[string]*patternNode)
+		}
+		if node.children[element] == nil {
+			node.children[element] = new(patternNode)
+		}
+		node = node.children[element]
+	}
+	node.patterns = append(node.patterns, m)
+}
+
+// matching appends the patterns which match modulePath to matches
+func (node *patternNode) matching(modulePath goproxy.ModulePath, matches []*AllowedModule) []*AllowedModule {
+	remaining := modulePath.String()
+	for node != nil {
+		for _, m := range node.patterns {
+			if matchPathPattern(m.PathPattern, modulePath.String()) {
+				matches = append(matches, m)
+			}
+		}
+		if remaining == "" {
+			break
+		}
+		var element string
+		element, remaining, _ = strings.Cut(remaining, "/")
+		node = node.children[element]
+	}
+	return matches
+}
+
+// An Allowlist is a compiled list of AllowedModules which can be matched efficiently:
+// entries with exact module paths are found using a map, and entries with path
+// patterns are found using a trie.
+type Allowlist struct {
+	modules  []AllowedModule
+	exact    map[goproxy.ModulePath]*pathRules
+	patterns patternNode
+}
+
+func CompileAllowlist(modules []AllowedModule) *Allowlist {
+	allowlist := &Allowlist{
+		modules: modules,
+		exact:   make(map[goproxy.ModulePath]*pathRules),
+	}
+	for i := range modules {
+		m := &modules[i]
+		if m.Path.IsSet() {
+			if allowlist.exact[m.Path] == nil {
+				allowlist.exact[m.Path] = new(pathRules)
+			}
+			allowlist.exact[m.Path].add(m)
+		} else {
+			allowlist.patterns.insert(m)
+		}
+	}
+	return allowlist
+}
+
+// Modules returns the allowlist's entries in their original order
+func (allowlist *Allowlist) Modules() []AllowedModule {
+	return allowlist.modules
+}
+
+// rules returns the rules for the given module path.  The returned value must not be modified.
+func (allowlist *Allowlist) rules(path goproxy.ModulePath) *pathRules {
+	exact := allowlist.exact[path]
+	patterns := allowlist.patterns.matching(path, nil)
+	if len(patterns) == 0 {
+		if exact == nil {
+			return new(pathRules)
+		}
+		return exact
+	}
+
+	rules := new(pathRules)
+	var entries []*AllowedModule
+	if exact != nil {
+		entries = append(entries, exact.entries...)
+	}
+	entries = append(entries, patterns...)
+	for _, m := range entries {
+		rules.add(m)
+	}
+	return rules
+}
+
+// IsAllowed reports whether the given module version is allowed by at least one entry
+// and is not denied by any entry
+func (allowlist *Allowlist) IsAllowed(path goproxy.ModulePath, version goproxy.ModuleVersion) bool {
+	return allowlist.rules(path).isAllowed(version)
+}
+
+// pinnedHashes returns the zip and go.mod hashes that the allowlist requires
+// for the given module version, or empty strings if no hash is required
+func (allowlist *Allowlist) pinnedHashes(path goproxy.ModulePath, version goproxy.ModuleVersion) (zipHash string, goModHash string) {
+	if exact := allowlist.exact[path]; exact != nil {
+		for _, m := range exact.entries {
+			if m.Version != version {
+				continue
+			}
+			if m.ZipHash != "" {
+				zipHash = m.ZipHash
+			}
+			if m.GoModHash != "" {
+				goModHash = m.GoModHash
+			}
+		}
+	}
+	return zipHash, goModHash
+}
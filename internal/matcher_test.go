@@ -0,0 +1,224 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+func compileTestAllowlist(t testing.TB, allowlist string) *Allowlist {
+	t.Helper()
+	modules, err := ReadAllowedModules(strings.NewReader(allowlist))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return CompileAllowlist(modules)
+}
+
+// linearIsAllowed is a straightforward implementation of Allowlist.IsAllowed which
+// scans every entry, against which the compiled matcher is checked and benchmarked
+func linearIsAllowed(modules []AllowedModule, path goproxy.ModulePath, version goproxy.ModuleVersion) bool {
+	allowed := false
+	for i := range modules {
+		m := &modules[i]
+		if m.Path.IsSet() && m.Path != path {
+			continue
+		} else if !m.Path.IsSet() && !matchPathPattern(m.PathPattern, path.String()) {
+			continue
+		} else if !m.matchesVersion(version) {
+			continue
+		}
+		if m.Deny {
+			return false
+		}
+		allowed = true
+	}
+	return allowed
+}
+
+const testAllowlist = `
+example.com/exact v1.2.3
+example.com/exact v1.3.0
+example.com/all *
+example.com/tree/... *
+example.com/*/single *
+example.com/deep/**/leaf >=v1.0.0
+example.com/constrained >=v1.2.0 <v2.0.0
+!example.com/constrained v1.5.0
+example.com/denytree/... *
+!example.com/denytree/bad/... *
+**/vendored v0.1.0
+`
+
+func TestAllowlistIsAllowed(t *testing.T) {
+	allowlist := compileTestAllowlist(t, testAllowlist)
+	tests := []struct {
+		path    goproxy.ModulePath
+		version goproxy.ModuleVersion
+		want    bool
+	}{
+		// exact path and version
+		{"example.com/exact", "v1.2.3", true},
+		{"example.com/exact", "v1.3.0", true},
+		{"example.com/exact", "v1.2.4", false},
+		{"example.com/exact/sub", "v1.2.3", false},
+		{"example.com/all", "v0.0.1", true},
+		{"example.com/alls", "v0.0.1", false},
+
+		// "/..." matches the path itself and everything beneath it
+		{"example.com/tree", "v1.0.0", true},
+		{"example.com/tree/a", "v1.0.0", true},
+		{"example.com/tree/a/b/c", "v1.0.0", true},
+		{"example.com/treehouse", "v1.0.0", false},
+
+		// "*" matches exactly one element
+		{"example.com/x/single", "v1.0.0", true},
+		{"example.com/single", "v1.0.0", false},
+		{"example.com/x/y/single", "v1.0.0", false},
+
+		// "**" matches zero or more elements
+		{"example.com/deep/leaf", "v1.0.0", true},
+		{"example.com/deep/a/b/leaf", "v1.1.0", true},
+		{"example.com/deep/a/b/leaf", "v0.9.0", false},
+		{"example.com/deep/a/b/leaf/more", "v1.0.0", false},
+		{"github.com/someone/vendored", "v0.1.0", true},
+		{"vendored", "v0.1.0", true},
+		{"github.com/someone/vendored", "v0.2.0", false},
+
+		// deny lines take precedence over allow lines
+		{"example.com/constrained", "v1.4.0", true},
+		{"example.com/constrained", "v1.5.0", false},
+		{"example.com/constrained", "v2.0.0", false},
+		{"example.com/denytree/good", "v1.0.0", true},
+		{"example.com/denytree/bad", "v1.0.0", false},
+		{"example.com/denytree/bad/sub", "v1.0.0", false},
+
+		{"example.org/unlisted", "v1.0.0", false},
+	}
+	for _, test := range tests {
+		if got := allowlist.IsAllowed(test.path, test.version); got != test.want {
+			t.Errorf("IsAllowed(%s, %s) = %v, want %v", test.path, test.version, got, test.want)
+		}
+		if got := linearIsAllowed(allowlist.Modules(), test.path, test.version); got != test.want {
+			t.Errorf("linearIsAllowed(%s, %s) = %v, want %v", test.path, test.version, got, test.want)
+		}
+	}
+}
+
+func TestAllowlistMinAge(t *testing.T) {
+	allowlist := compileTestAllowlist(t, `
+example.com/a * min-age=7d
+example.com/a v1.0.0 min-age=1h
+example.com/b/... * min-age=2d
+example.com/b/c >=v1.0.0
+!example.com/b/c v1.1.0
+example.com/d *
+`)
+	const defaultMinAge = 3 * 24 * time.Hour
+	tests := []struct {
+		path    goproxy.ModulePath
+		version goproxy.ModuleVersion
+		want    time.Duration
+	}{
+		{"example.com/a", "v1.0.0", time.Hour},
+		{"example.com/a", "v1.1.0", 7 * 24 * time.Hour},
+		{"example.com/b/c", "v1.0.0", 2 * 24 * time.Hour},
+		{"example.com/b/c", "v0.1.0", 2 * 24 * time.Hour},
+		{"example.com/d", "v1.0.0", defaultMinAge},
+	}
+	for _, test := range tests {
+		if got := allowlist.rules(test.path).minAge(test.version, defaultMinAge); got != test.want {
+			t.Errorf("minAge(%s, %s) = %s, want %s", test.path, test.version, got, test.want)
+		}
+	}
+	if !allowlist.rules("example.com/a").hasMinAge(0) {
+		t.Errorf("hasMinAge(example.com/a) = false, want true")
+	}
+	if allowlist.rules("example.com/d").hasMinAge(0) {
+		t.Errorf("hasMinAge(example.com/d) = true, want false")
+	}
+}
+
+func TestAllowlistDecidingEntry(t *testing.T) {
+	allowlist := compileTestAllowlist(t, testAllowlist)
+	tests := []struct {
+		path    goproxy.ModulePath
+		version goproxy.ModuleVersion
+		line    int // 0 if no entry decides
+	}{
+		{"example.com/exact", "v1.3.0", 3},
+		{"example.com/constrained", "v1.4.0", 8},
+		{"example.com/constrained", "v1.5.0", 9},
+		{"example.com/denytree/bad/x", "v1.0.0", 11},
+		{"example.com/denytree/bad/x", "", 11},
+		{"example.com/exact", "", 0},
+		{"example.org/unlisted", "v1.0.0", 0},
+	}
+	for _, test := range tests {
+		entry := allowlist.rules(test.path).decidingEntry(test.version)
+		line := 0
+		if entry != nil {
+			line = entry.Line
+		}
+		if line != test.line {
+			t.Errorf("decidingEntry(%s, %q) is on line %d, want %d", test.path, test.version, line, test.line)
+		}
+	}
+}
+
+// benchmarkAllowlist returns an allowlist with n exact entries and n/10 pattern entries,
+// along with a module path that is matched by some of them
+func benchmarkAllowlist(b *testing.B, n int) (*Allowlist, goproxy.ModulePath) {
+	var allowlist strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&allowlist, "github.com/org%d/repo%d v1.%d.0\n", i%50, i, i%10)
+	}
+	for i := 0; i < n/10; i++ {
+		fmt.Fprintf(&allowlist, "example.com/org%d/... *\n", i)
+	}
+	return compileTestAllowlist(b, allowlist.String()), goproxy.ModulePath(fmt.Sprintf("github.com/org%d/repo%d", (n/2)%50, n/2))
+}
+
+func BenchmarkAllowlistIsAllowed(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		allowlist, path := benchmarkAllowlist(b, n)
+		b.Run(fmt.Sprintf("compiled/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				allowlist.IsAllowed(path, "v1.0.0")
+			}
+		})
+		b.Run(fmt.Sprintf("linear/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				linearIsAllowed(allowlist.Modules(), path, "v1.0.0")
+			}
+		})
+	}
+}
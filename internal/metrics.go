@@ -0,0 +1,225 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Histogram buckets for durations, in seconds
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Histogram buckets for sizes, in bytes
+var sizeBuckets = []float64{1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20}
+
+// A metricVec is a family of counters or histograms, written in the Prometheus text format
+type metricVec struct {
+	name       string
+	help       string
+	labelNames []string
+	buckets    []float64 // if nil, the metric is a counter
+
+	mu     sync.Mutex
+	series map[string]*metricSeries // keyed by label values joined with \xff
+}
+
+type metricSeries struct {
+	labelValues []string
+	counts      []uint64 // for histograms, the number of observations in each bucket (not cumulative)
+	count       uint64
+	sum         float64
+}
+
+func newCounterVec(name, help string, labelNames ...string) *metricVec {
+	return &metricVec{name: name, help: help, labelNames: labelNames}
+}
+
+func newHistogramVec(name, help string, buckets []float64, labelNames ...string) *metricVec {
+	return &metricVec{name: name, help: help, labelNames: labelNames, buckets: buckets}
+}
+
+// observe adds value to the counter, or records an observation of value in the histogram,
+// with the given label values
+func (vec *metricVec) observe(value float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+
+	vec.mu.Lock()
+	defer vec.mu.Unlock()
+
+	if vec.series == nil {
+		vec.series = make(map[string]*metricSeries)
+	}
+	series := vec.series[key]
+	if series == nil {
+		series = &metricSeries{labelValues: labelValues, counts: make([]uint64, len(vec.buckets))}
+		vec.series[key] = series
+	}
+	series.count++
+	series.sum += value
+	if i, _ := slices.BinarySearch(vec.buckets, value); i < len(vec.buckets) {
+		series.counts[i]++
+	}
+}
+
+func (vec *metricVec) inc(labelValues ...string) {
+	vec.observe(1, labelValues...)
+}
+
+func (vec *metricVec) observeSince(start time.Time, labelValues ...string) {
+	vec.observe(time.Since(start).Seconds(), labelValues...)
+}
+
+func formatMetricValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// formatLabels formats the given label names and values, followed by the extra name and value if extraName is non-empty
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	var pairs []string
+	for i := range names {
+		pairs = append(pairs, names[i]+"="+strconv.Quote(values[i]))
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+"="+strconv.Quote(extraValue))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (vec *metricVec) write(w *bufio.Writer) {
+	vec.mu.Lock()
+	defer vec.mu.Unlock()
+
+	keys := make([]string, 0, len(vec.series))
+	for key := range vec.series {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	fmt.Fprintf(w, "# HELP %s %s\n", vec.name, vec.help)
+	if vec.buckets == nil {
+		fmt.Fprintf(w, "# TYPE %s counter\n", vec.name)
+		for _, key := range keys {
+			series := vec.series[key]
+			fmt.Fprintf(w, "%s%s %s\n", vec.name, formatLabels(vec.labelNames, series.labelValues, "", ""), formatMetricValue(series.sum))
+		}
+		return
+	}
+	fmt.Fprintf(w, "# TYPE %s histogram\n", vec.name)
+	for _, key := range keys {
+		series := vec.series[key]
+		var cumulative uint64
+		for i, bucket := range vec.buckets {
+			cumulative += series.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", vec.name, formatLabels(vec.labelNames, series.labelValues, "le", formatMetricValue(bucket)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", vec.name, formatLabels(vec.labelNames, series.labelValues, "le", "+Inf"), series.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", vec.name, formatLabels(vec.labelNames, series.labelValues, "", ""), formatMetricValue(series.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", vec.name, formatLabels(vec.labelNames, series.labelValues, "", ""), series.count)
+	}
+}
+
+func writeGauge(w *bufio.Writer, name, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s gauge\n", name)
+	fmt.Fprintf(w, "%s %s\n", name, formatMetricValue(value))
+}
+
+type metrics struct {
+	proxyRequests    *metricVec
+	upstreamRequests *metricVec
+	upstreamDuration *metricVec
+	diffDuration     *metricVec
+	diffSize         *metricVec
+	dashboardRefresh *metricVec
+	allowlistLoads   *metricVec
+	cacheRequests    *metricVec
+
+	mu              sync.Mutex
+	allowlistLoaded time.Time
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		proxyRequests:    newCounterVec("depproxy_proxy_requests_total", "Number of module proxy requests, by request type and decision.", "type", "decision"),
+		upstreamRequests: newCounterVec("depproxy_upstream_requests_total", "Number of requests to the upstream proxy, by request type and result.", "type", "result"),
+		upstreamDuration: newHistogramVec("depproxy_upstream_request_duration_seconds", "Time taken by the upstream proxy to respond, by request type.", durationBuckets, "type"),
+		diffDuration:     newHistogramVec("depproxy_diff_duration_seconds", "Time taken to generate diffs between module versions.", durationBuckets),
+		diffSize:         newHistogramVec("depproxy_diff_size_bytes", "Size of diffs between module versions.", sizeBuckets),
+		dashboardRefresh: newHistogramVec("depproxy_dashboard_refresh_duration_seconds", "Time taken to gather the information shown on the dashboard.", durationBuckets),
+		allowlistLoads:   newCounterVec("depproxy_allowlist_loads_total", "Number of attempts to load the allowlist, by result.", "result"),
+		cacheRequests:    newCounterVec("depproxy_cache_requests_total", "Number of lookups in the module cache, by result.", "result"),
+	}
+}
+
+func (s *Server) getMetrics() *metrics {
+	s.metricsOnce.Do(func() { s.metrics = newMetrics() })
+	return s.metrics
+}
+
+// AllowlistLoadFailed records a failed attempt to reload the allowlist, for metrics
+func (s *Server) AllowlistLoadFailed() {
+	s.getMetrics().allowlistLoads.inc("failure")
+}
+
+func (s *Server) recordAllowlistLoad() {
+	m := s.getMetrics()
+	m.allowlistLoads.inc("success")
+	m.mu.Lock()
+	m.allowlistLoaded = time.Now()
+	m.mu.Unlock()
+}
+
+func (s *Server) serveMetrics(w http.ResponseWriter, req *http.Request) {
+	m := s.getMetrics()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=UTF-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+
+	for _, vec := range []*metricVec{m.proxyRequests, m.upstreamRequests, m.upstreamDuration, m.diffDuration, m.diffSize, m.dashboardRefresh, m.allowlistLoads, m.cacheRequests} {
+		vec.write(out)
+	}
+	writeGauge(out, "depproxy_allowlist_entries", "Number of entries in the current allowlist.", float64(len(s.getAllowedModules())))
+	m.mu.Lock()
+	loaded := m.allowlistLoaded
+	m.mu.Unlock()
+	if !loaded.IsZero() {
+		writeGauge(out, "depproxy_allowlist_last_load_timestamp_seconds", "Time at which the current allowlist was loaded, in seconds since the Unix epoch.", float64(loaded.UnixNano())/1e9)
+	}
+}
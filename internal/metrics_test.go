@@ -0,0 +1,132 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"bufio"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func writeMetricVec(vec *metricVec) string {
+	var buf strings.Builder
+	w := bufio.NewWriter(&buf)
+	vec.write(w)
+	w.Flush()
+	return buf.String()
+}
+
+func TestFormatLabels(t *testing.T) {
+	tests := []struct {
+		names      []string
+		values     []string
+		extraName  string
+		extraValue string
+		want       string
+	}{
+		{nil, nil, "", "", ""},
+		{[]string{"type"}, []string{"ZipRequest"}, "", "", `{type="ZipRequest"}`},
+		{[]string{"type", "decision"}, []string{"ZipRequest", "deny"}, "", "", `{type="ZipRequest",decision="deny"}`},
+		{[]string{"type"}, []string{"ZipRequest"}, "le", "0.5", `{type="ZipRequest",le="0.5"}`},
+		{nil, nil, "le", "+Inf", `{le="+Inf"}`},
+		{[]string{"x"}, []string{"a\"b\\c\n"}, "", "", `{x="a\"b\\c\n"}`},
+	}
+	for _, test := range tests {
+		if got := formatLabels(test.names, test.values, test.extraName, test.extraValue); got != test.want {
+			t.Errorf("formatLabels(%q, %q, %q, %q) = %s, want %s", test.names, test.values, test.extraName, test.extraValue, got, test.want)
+		}
+	}
+}
+
+func TestMetricVecWrite(t *testing.T) {
+	counter := newCounterVec("test_requests_total", "Number of requests.", "type", "result")
+	counter.inc("zip", "ok")
+	counter.inc("mod", "ok")
+	counter.inc("zip", "ok")
+	counter.inc("zip", "error")
+
+	histogram := newHistogramVec("test_duration_seconds", "Duration.", []float64{0.1, 1}, "type")
+	histogram.observe(0.05, "zip")
+	histogram.observe(0.1, "zip")
+	histogram.observe(0.5, "zip")
+	histogram.observe(5, "zip")
+
+	tests := []struct {
+		vec  *metricVec
+		want string
+	}{
+		{newCounterVec("test_empty_total", "Nothing."), "# HELP test_empty_total Nothing.\n# TYPE test_empty_total counter\n"},
+		{counter, `# HELP test_requests_total Number of requests.
+# TYPE test_requests_total counter
+test_requests_total{type="mod",result="ok"} 1
+test_requests_total{type="zip",result="error"} 1
+test_requests_total{type="zip",result="ok"} 2
+`},
+		{histogram, `# HELP test_duration_seconds Duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{type="zip",le="0.1"} 2
+test_duration_seconds_bucket{type="zip",le="1"} 3
+test_duration_seconds_bucket{type="zip",le="+Inf"} 4
+test_duration_seconds_sum{type="zip"} 5.65
+test_duration_seconds_count{type="zip"} 4
+`},
+	}
+	for _, test := range tests {
+		if got := writeMetricVec(test.vec); got != test.want {
+			t.Errorf("%s written as:\n%s\nwant:\n%s", test.vec.name, got, test.want)
+		}
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	upstream := newTestUpstream(t, "v1.0.0")
+	s := newTestServer(t, upstream.URL, "example.com/m v1.0.0\nexample.com/n *\n")
+	serveTestRequest(s, "/proxy/example.com/m/@v/v1.0.0.info")
+	serveTestRequest(s, "/proxy/example.com/m/@v/v1.1.0.zip")
+	serveTestRequest(s, "/proxy/example.com/m/@v/list")
+	s.AllowlistLoadFailed()
+
+	rec := serveTestRequest(s, "/metrics")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/metrics returned status %d", rec.Code)
+	}
+	for _, want := range []string{
+		`depproxy_proxy_requests_total{type="InfoRequest",decision="allow"} 1`,
+		`depproxy_proxy_requests_total{type="ZipRequest",decision="deny"} 1`,
+		`depproxy_proxy_requests_total{type="ListRequest",decision="allow"} 1`,
+		`depproxy_upstream_requests_total{type="ListRequest",result="ok"} 1`,
+		`depproxy_upstream_request_duration_seconds_count{type="ListRequest"} 1`,
+		`depproxy_allowlist_loads_total{result="success"} 1`,
+		`depproxy_allowlist_loads_total{result="failure"} 1`,
+		"depproxy_allowlist_entries 2",
+		"depproxy_allowlist_last_load_timestamp_seconds ",
+	} {
+		if !strings.Contains(rec.Body.String(), "\n"+want) {
+			t.Errorf("/metrics does not contain %q", want)
+		}
+	}
+}
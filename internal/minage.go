@@ -0,0 +1,156 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+const (
+	// How long to remember that the publication time of a module version could not be
+	// determined, so that repeated requests for a missing version don't each query the
+	// upstream proxy
+	versionTimeErrorCacheDuration = time.Minute
+
+	// Maximum number of module versions whose publication times are remembered; when
+	// exceeded, expired entries and then arbitrary entries are forgotten
+	maxVersionTimes = 50000
+)
+
+type cachedVersionTime struct {
+	time    time.Time
+	err     error
+	expires time.Time // zero if the entry never expires
+}
+
+func (cached *cachedVersionTime) isExpired(now time.Time) bool {
+	return !cached.expires.IsZero() && !now.Before(cached.expires)
+}
+
+// getVersionTime returns the time at which the given module version was published, according
+// to the upstream proxy.  Since this never changes, it is cached.  Errors are cached for
+// versionTimeErrorCacheDuration.
+func (s *Server) getVersionTime(ctx context.Context, module goproxy.ModulePath, version goproxy.ModuleVersion) (time.Time, error) {
+	key := module.String() + "@" + version.String()
+	if cached, ok := s.loadVersionTime(key); ok {
+		return cached.time, cached.err
+	}
+	info, err := s.getModuleInfo(ctx, module, version)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.storeVersionTime(key, &cachedVersionTime{err: err, expires: time.Now().Add(versionTimeErrorCacheDuration)})
+		}
+		return time.Time{}, err
+	}
+	s.storeVersionTime(key, &cachedVersionTime{time: info.Time})
+	return info.Time, nil
+}
+
+func (s *Server) loadVersionTime(key string) (*cachedVersionTime, bool) {
+	s.versionTimesMu.Lock()
+	defer s.versionTimesMu.Unlock()
+	cached, ok := s.versionTimes[key]
+	if !ok || cached.isExpired(time.Now()) {
+		return nil, false
+	}
+	return cached, true
+}
+
+func (s *Server) storeVersionTime(key string, cached *cachedVersionTime) {
+	s.versionTimesMu.Lock()
+	defer s.versionTimesMu.Unlock()
+	if s.versionTimes == nil {
+		s.versionTimes = make(map[string]*cachedVersionTime)
+	}
+	if len(s.versionTimes) >= maxVersionTimes {
+		s.evictVersionTimes(time.Now(), maxVersionTimes*9/10)
+	}
+	s.versionTimes[key] = cached
+}
+
+// evictVersionTimes forgets expired entries, and then arbitrary entries until at most
+// limit remain.  Forgotten publication times are fetched again when needed.  The
+// caller must hold versionTimesMu.
+func (s *Server) evictVersionTimes(now time.Time, limit int) {
+	for key, cached := range s.versionTimes {
+		if cached.isExpired(now) {
+			delete(s.versionTimes, key)
+		}
+	}
+	for key := range s.versionTimes {
+		if len(s.versionTimes) <= limit {
+			break
+		}
+		delete(s.versionTimes, key)
+	}
+}
+
+// getEligibleTime returns the time at which the given module version becomes old enough to
+// be allowed, or the zero time if no minimum age applies to it
+func (s *Server) getEligibleTime(ctx context.Context, rules *pathRules, module goproxy.ModulePath, version goproxy.ModuleVersion) (time.Time, error) {
+	minAge := rules.minAge(version, s.MinAge)
+	if minAge == 0 {
+		return time.Time{}, nil
+	}
+	published, err := s.getVersionTime(ctx, module, version)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return published.Add(minAge), nil
+}
+
+// filterByMinAge returns the versions which are old enough to be allowed.  Versions whose
+// age cannot be determined are omitted.
+func (s *Server) filterByMinAge(ctx context.Context, rules *pathRules, module goproxy.ModulePath, versions []goproxy.ModuleVersion) []goproxy.ModuleVersion {
+	if !rules.hasMinAge(s.MinAge) {
+		return versions
+	}
+
+	now := time.Now()
+	eligible := make([]bool, len(versions))
+	var group errgroup.Group
+	group.SetLimit(10)
+	for i, version := range versions {
+		group.Go(func() error {
+			eligibleTime, err := s.getEligibleTime(ctx, rules, module, version)
+			eligible[i] = err == nil && !eligibleTime.After(now)
+			return nil
+		})
+	}
+	group.Wait()
+
+	filtered := []goproxy.ModuleVersion{}
+	for i, version := range versions {
+		if eligible[i] {
+			filtered = append(filtered, version)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,181 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+func TestGetVersionTimeCache(t *testing.T) {
+	published := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	var requests atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		if strings.HasSuffix(req.URL.Path, "/@v/v1.0.0.info") {
+			fmt.Fprintf(w, `{"Version":"v1.0.0","Time":%q}`, published.Format(time.RFC3339))
+		} else {
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+	defer upstream.Close()
+	s := newTestServer(t, upstream.URL, "example.com/m *\n")
+	ctx := context.Background()
+
+	tests := []struct {
+		version      goproxy.ModuleVersion
+		wantErr      bool
+		wantRequests int32
+	}{
+		{"v1.0.0", false, 1},
+		{"v1.0.0", false, 1}, // cached
+		{"v2.0.0", true, 2},
+		{"v2.0.0", true, 2}, // error is cached
+	}
+	for _, test := range tests {
+		got, err := s.getVersionTime(ctx, "example.com/m", test.version)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("getVersionTime(%s) succeeded, want error", test.version)
+			}
+		} else if err != nil {
+			t.Errorf("getVersionTime(%s) failed: %s", test.version, err)
+		} else if !got.Equal(published) {
+			t.Errorf("getVersionTime(%s) = %s, want %s", test.version, got, published)
+		}
+		if n := requests.Load(); n != test.wantRequests {
+			t.Errorf("after getVersionTime(%s), upstream received %d requests, want %d", test.version, n, test.wantRequests)
+		}
+	}
+
+	// Once the cached error expires, the upstream proxy is queried again
+	s.versionTimes["example.com/m@v2.0.0"].expires = time.Now().Add(-time.Second)
+	if _, err := s.getVersionTime(ctx, "example.com/m", "v2.0.0"); err == nil {
+		t.Errorf("getVersionTime(v2.0.0) succeeded, want error")
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("upstream received %d requests, want 3", n)
+	}
+}
+
+func TestEvictVersionTimes(t *testing.T) {
+	now := time.Now()
+	s := new(Server)
+	s.storeVersionTime("example.com/a@v1.0.0", &cachedVersionTime{time: now})
+	s.storeVersionTime("example.com/b@v1.0.0", &cachedVersionTime{time: now})
+	s.storeVersionTime("example.com/c@v1.0.0", &cachedVersionTime{err: errNotFound, expires: now.Add(-time.Second)})
+	s.storeVersionTime("example.com/d@v1.0.0", &cachedVersionTime{err: errNotFound, expires: now.Add(time.Minute)})
+
+	tests := []struct {
+		limit int
+		want  int
+	}{
+		{10, 3}, // only the expired entry is evicted
+		{2, 2},
+		{0, 0},
+	}
+	for _, test := range tests {
+		s.evictVersionTimes(now, test.limit)
+		if got := len(s.versionTimes); got != test.want {
+			t.Errorf("after evictVersionTimes(%d), %d entries remain, want %d", test.limit, got, test.want)
+		}
+		if _, ok := s.versionTimes["example.com/c@v1.0.0"]; ok {
+			t.Errorf("after evictVersionTimes(%d), expired entry remains", test.limit)
+		}
+	}
+}
+
+func TestMinAgePolicy(t *testing.T) {
+	now := time.Now()
+	published := map[string]time.Time{
+		"v1.0.0": now.Add(-365 * 24 * time.Hour),
+		"v1.1.0": now.Add(-time.Hour),
+		"v1.2.0": now.Add(-3 * 24 * time.Hour),
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, file, _ := strings.Cut(req.URL.Path, "/@v/")
+		version, isInfo := strings.CutSuffix(file, ".info")
+		if file == "list" {
+			fmt.Fprint(w, "v1.0.0\nv1.1.0\nv1.2.0\n")
+		} else if t, ok := published[version]; isInfo && ok {
+			fmt.Fprintf(w, `{"Version":%q,"Time":%q}`, version, t.Format(time.RFC3339))
+		} else {
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+	defer upstream.Close()
+	s := newTestServer(t, upstream.URL, `
+example.com/m *
+example.com/fast * min-age=2d
+example.com/zero * min-age=0
+example.com/mixed >=v1.2.0 min-age=1d
+example.com/mixed *
+`)
+	s.MinAge = 7 * 24 * time.Hour
+
+	listTests := []struct {
+		module string
+		want   string
+	}{
+		{"example.com/m", "v1.0.0\n"},
+		{"example.com/fast", "v1.0.0\nv1.2.0\n"},
+		{"example.com/zero", "v1.0.0\nv1.1.0\nv1.2.0\n"},
+		{"example.com/mixed", "v1.0.0\nv1.2.0\n"},
+	}
+	for _, test := range listTests {
+		if rec := serveTestRequest(s, "/proxy/"+test.module+"/@v/list"); rec.Body.String() != test.want {
+			t.Errorf("list of %s returned %q, want %q", test.module, rec.Body.String(), test.want)
+		}
+	}
+
+	zipTests := []struct {
+		module     string
+		version    string
+		wantStatus int
+	}{
+		{"example.com/m", "v1.0.0", http.StatusSeeOther},
+		{"example.com/m", "v1.1.0", http.StatusForbidden},
+		{"example.com/m", "v1.2.0", http.StatusForbidden},
+		{"example.com/m", "v9.0.0", http.StatusNotFound},
+		{"example.com/fast", "v1.2.0", http.StatusSeeOther},
+		{"example.com/fast", "v1.1.0", http.StatusForbidden},
+		{"example.com/zero", "v1.1.0", http.StatusSeeOther},
+		{"example.com/zero", "v9.0.0", http.StatusSeeOther},
+	}
+	for _, test := range zipTests {
+		if rec := serveTestRequest(s, "/proxy/"+test.module+"/@v/"+test.version+".zip"); rec.Code != test.wantStatus {
+			t.Errorf("zip of %s@%s returned status %d, want %d", test.module, test.version, rec.Code, test.wantStatus)
+		}
+	}
+}
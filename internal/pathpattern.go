@@ -0,0 +1,88 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"errors"
+	"path"
+	"strings"
+)
+
+// Module path patterns are matched one slash-separated element at a time.  Each element
+// is a path.Match pattern, except for "**", which matches zero or more elements.  A
+// final element of "..." is equivalent to "**", so "example.com/foo/..." matches
+// example.com/foo and every module path beneath it, as in go command package patterns.
+
+func isPathPattern(str string) bool {
+	return strings.ContainsAny(str, "*?[") || str == "..." || strings.HasSuffix(str, "/...")
+}
+
+func checkPathPattern(pattern string) error {
+	elements := strings.Split(pattern, "/")
+	for i, element := range elements {
+		if element == "..." {
+			if i != len(elements)-1 {
+				return errors.New("... may only appear as the final element of a module path pattern")
+			}
+		} else if element == "**" {
+			continue
+		} else if strings.Contains(element, "...") {
+			return errors.New("... must be a complete element of a module path pattern")
+		} else if strings.Contains(element, "**") {
+			return errors.New("** must be a complete element of a module path pattern")
+		} else if _, err := path.Match(element, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchPathPattern reports whether modulePath matches pattern, which must be valid
+// according to checkPathPattern
+func matchPathPattern(pattern string, modulePath string) bool {
+	return matchPathElements(strings.Split(pattern, "/"), strings.Split(modulePath, "/"))
+}
+
+func matchPathElements(pattern []string, elements []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" || pattern[0] == "..." {
+			for i := 0; i <= len(elements); i++ {
+				if matchPathElements(pattern[1:], elements[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elements) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], elements[0]); !matched {
+			return false
+		}
+		pattern, elements = pattern[1:], elements[1:]
+	}
+	return len(elements) == 0
+}
@@ -0,0 +1,111 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"testing"
+)
+
+func TestIsPathPattern(t *testing.T) {
+	tests := []struct {
+		str  string
+		want bool
+	}{
+		{"example.com/m", false},
+		{"example.com/m.../x", false},
+		{"example.com/*", true},
+		{"example.com/m?", true},
+		{"example.com/[ab]", true},
+		{"example.com/...", true},
+		{"...", true},
+		{"example.com/**/m", true},
+	}
+	for _, test := range tests {
+		if got := isPathPattern(test.str); got != test.want {
+			t.Errorf("isPathPattern(%q) = %v, want %v", test.str, got, test.want)
+		}
+	}
+}
+
+func TestCheckPathPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		wantErr bool
+	}{
+		{"example.com/*", false},
+		{"example.com/...", false},
+		{"example.com/**", false},
+		{"**/m", false},
+		{"example.com/**/m/...", false},
+		{"example.com/[a-z]*", false},
+		{"...", false},
+		{"example.com/.../m", true},
+		{"example.com/m...", true},
+		{"example.com/m**", true},
+		{"example.com/**m", true},
+		{"example.com/[", true},
+		{"example.com/\\", true},
+	}
+	for _, test := range tests {
+		if err := checkPathPattern(test.pattern); (err != nil) != test.wantErr {
+			t.Errorf("checkPathPattern(%q) = %v, want error = %v", test.pattern, err, test.wantErr)
+		}
+	}
+}
+
+func TestMatchPathPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"github.com/aws/*", "github.com/aws/sdk", true},
+		{"github.com/aws/*", "github.com/aws/sdk/service/s3", false},
+		{"github.com/aws/*", "github.com/aws", false},
+		{"github.com/aws/...", "github.com/aws", true},
+		{"github.com/aws/...", "github.com/aws/sdk", true},
+		{"github.com/aws/...", "github.com/aws/sdk/service/s3", true},
+		{"github.com/aws/...", "github.com/awsome", false},
+		{"github.com/aws/aws-sdk-go-v2/...", "github.com/aws/aws-sdk-go-v2/service/s3", true},
+		{"github.com/**/s3", "github.com/aws/aws-sdk-go-v2/service/s3", true},
+		{"github.com/**/s3", "github.com/s3", true},
+		{"github.com/**/s3", "github.com/aws/s3/v2", false},
+		{"**/s3", "s3", true},
+		{"**", "example.com/anything/at/all", true},
+		{"...", "example.com", true},
+		{"github.com/*/*/...", "github.com/aws", false},
+		{"github.com/*/*/...", "github.com/aws/sdk", true},
+		{"github.com/aws-*/...", "github.com/aws-labs/x", true},
+		{"github.com/aws-*/...", "github.com/aws/x", false},
+		{"example.com/m?", "example.com/m1", true},
+		{"example.com/m?", "example.com/m12", false},
+	}
+	for _, test := range tests {
+		if got := matchPathPattern(test.pattern, test.path); got != test.want {
+			t.Errorf("matchPathPattern(%q, %q) = %v, want %v", test.pattern, test.path, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+// A PrivateSumDB is a checksum database, stored in a directory, containing the hashes of
+// module versions which depproxy has served.  Its records are stored in a single append-only
+// file, with each record followed by a blank line.  The log's hashes are recomputed from the
+// records when the database is opened.
+type PrivateSumDB struct {
+	signer note.Signer
+	file   *os.File
+
+	mu      sync.RWMutex
+	size    int64 // size of the valid part of the records file
+	records [][]byte
+	hashes  []tlog.Hash // stored hashes, as defined by tlog.StoredHashIndex
+	index   map[module.Version]int64
+}
+
+// OpenPrivateSumDB opens the private checksum database in dir, creating it if necessary,
+// which signs its tree heads using signer
+func OpenPrivateSumDB(dir string, signer note.Signer) (*PrivateSumDB, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filepath.Join(dir, "records"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	db := &PrivateSumDB{
+		signer: signer,
+		file:   file,
+		index:  make(map[module.Version]int64),
+	}
+	if err := db.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Name returns the name of the checksum database, which is the name of its key
+func (db *PrivateSumDB) Name() string {
+	return db.signer.Name()
+}
+
+func (db *PrivateSumDB) load() error {
+	data, err := os.ReadFile(db.file.Name())
+	if err != nil {
+		return err
+	}
+	for {
+		record, rest, found := bytes.Cut(data, []byte("\n\n"))
+		if !found {
+			break
+		}
+		record = append(record, '\n')
+		if err := db.addRecord(record); err != nil {
+			return fmt.Errorf("%s: record %d: %w", db.file.Name(), len(db.records), err)
+		}
+		db.size += int64(len(record)) + 1
+		data = rest
+	}
+	if len(data) > 0 {
+		// A record was only partially written, probably because depproxy crashed
+		log.Printf("discarding incomplete record at end of %s", db.file.Name())
+		if err := db.file.Truncate(db.size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readHashes implements tlog.HashReader
+func (db *PrivateSumDB) readHashes(indexes []int64) ([]tlog.Hash, error) {
+	hashes := make([]tlog.Hash, len(indexes))
+	for i, index := range indexes {
+		if index < 0 || index >= int64(len(db.hashes)) {
+			return nil, fs.ErrNotExist
+		}
+		hashes[i] = db.hashes[index]
+	}
+	return hashes, nil
+}
+
+// addRecord adds a record to the in-memory log.  db.mu must be held for writing.
+func (db *PrivateSumDB) addRecord(record []byte) error {
+	var versions []module.Version
+	for _, line := range strings.Split(strings.TrimSuffix(string(record), "\n"), "\n") {
+		f := strings.Fields(line)
+		if len(f) != 3 {
+			return fmt.Errorf("malformed line %q", line)
+		}
+		versions = append(versions, module.Version{Path: f[0], Version: strings.TrimSuffix(f[1], "/go.mod")})
+	}
+	id := int64(len(db.records))
+	hashes, err := tlog.StoredHashes(id, record, tlog.HashReaderFunc(db.readHashes))
+	if err != nil {
+		return err
+	}
+	db.records = append(db.records, record)
+	db.hashes = append(db.hashes, hashes...)
+	for _, version := range versions {
+		db.index[version] = id
+	}
+	return nil
+}
+
+func (db *PrivateSumDB) lookup(version module.Version) (int64, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	id, ok := db.index[version]
+	return id, ok
+}
+
+// add appends a record containing the zip and go.mod hashes of the given module version
+// to the log, unless the log already has one, and returns the record's ID
+func (db *PrivateSumDB) add(version module.Version, zipHash string, goModHash string) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if id, ok := db.index[version]; ok {
+		return id, nil
+	}
+	record := fmt.Appendf(nil, "%s %s %s\n%s %s/go.mod %s\n", version.Path, version.Version, zipHash, version.Path, version.Version, goModHash)
+	if _, err := db.file.WriteAt(append(record, '\n'), db.size); err != nil {
+		db.file.Truncate(db.size)
+		return 0, err
+	}
+	if err := db.file.Sync(); err != nil {
+		db.file.Truncate(db.size)
+		return 0, err
+	}
+	if err := db.addRecord(record); err != nil {
+		db.file.Truncate(db.size)
+		return 0, err
+	}
+	db.size += int64(len(record)) + 1
+	return int64(len(db.records)) - 1, nil
+}
+
+func (db *PrivateSumDB) signed() ([]byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	tree := tlog.Tree{N: int64(len(db.records))}
+	var err error
+	tree.Hash, err = tlog.TreeHash(tree.N, tlog.HashReaderFunc(db.readHashes))
+	if err != nil {
+		return nil, err
+	}
+	return note.Sign(&note.Note{Text: string(tlog.FormatTree(tree))}, db.signer)
+}
+
+func (db *PrivateSumDB) readRecords(id, n int64) ([][]byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if id < 0 || n < 0 || id+n > int64(len(db.records)) {
+		return nil, fs.ErrNotExist
+	}
+	return db.records[id : id+n], nil
+}
+
+func (db *PrivateSumDB) readTileData(tile tlog.Tile) ([]byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return tlog.ReadTileData(tile, tlog.HashReaderFunc(db.readHashes))
+}
+
+// privateSumDBOps implements sumdb.ServerOps.  Module versions which aren't yet in the log are
+// added when they're looked up, provided that depproxy would serve them.
+type privateSumDBOps struct {
+	server *Server
+}
+
+func (ops *privateSumDBOps) Signed(ctx context.Context) ([]byte, error) {
+	return ops.server.PrivateSumDB.signed()
+}
+
+func (ops *privateSumDBOps) ReadRecords(ctx context.Context, id, n int64) ([][]byte, error) {
+	return ops.server.PrivateSumDB.readRecords(id, n)
+}
+
+func (ops *privateSumDBOps) ReadTileData(ctx context.Context, tile tlog.Tile) ([]byte, error) {
+	return ops.server.PrivateSumDB.readTileData(tile)
+}
+
+func (ops *privateSumDBOps) Lookup(ctx context.Context, m module.Version) (int64, error) {
+	db := ops.server.PrivateSumDB
+	if id, ok := db.lookup(m); ok {
+		return id, nil
+	}
+	zipHash, goModHash, err := ops.server.hashServableVersion(ctx, m)
+	if err != nil {
+		log.Printf("not adding %s to private checksum database: %s", m, err)
+		// sumdb.Server responds with 404 only if os.IsNotExist(err), which doesn't unwrap errors
+		return 0, &fs.PathError{Op: "lookup", Path: m.String(), Err: fs.ErrNotExist}
+	}
+	return db.add(m, zipHash, goModHash)
+}
+
+// hashServableVersion returns the zip and go.mod hashes of the given module version, or an error
+// if depproxy wouldn't serve it.  The files are subject to the same verification as when they're
+// served.
+func (s *Server) hashServableVersion(ctx context.Context, m module.Version) (zipHash string, goModHash string, err error) {
+	path, err := goproxy.MakeModulePath(m.Path)
+	if err != nil {
+		return "", "", err
+	}
+	version, err := goproxy.MakeModuleVersion(m.Version)
+	if err != nil {
+		return "", "", err
+	}
+	rules := s.getAllowlist().rules(path)
+	if !rules.isAllowed(version) {
+		return "", "", fmt.Errorf("version is not allowed")
+	}
+	if err := s.checkVersionPolicies(ctx, rules, path, version); err != nil {
+		return "", "", err
+	}
+
+	zipReq, modReq := goproxy.ZipRequest{Version: version}, goproxy.ModRequest{Version: version}
+	zip, err := s.fetchFile(ctx, path, zipReq, func(content []byte) error { return s.verifyFile(path, zipReq, content) })
+	if err != nil {
+		return "", "", err
+	}
+	goMod, err := s.fetchFile(ctx, path, modReq, func(content []byte) error { return s.verifyFile(path, modReq, content) })
+	if err != nil {
+		return "", "", err
+	}
+
+	if zipHash, err = hashZipBytes(zip); err != nil {
+		return "", "", err
+	}
+	if goModHash, err = hashGoMod(goMod); err != nil {
+		return "", "", err
+	}
+	return zipHash, goModHash, nil
+}
+
+func (s *Server) privateSumDBHandler() http.Handler {
+	return sumdb.NewServer(&privateSumDBOps{server: s})
+}
+
+// servePrivateSumDB serves the private checksum database under /sumdb/
+func (s *Server) servePrivateSumDB(w http.ResponseWriter, req *http.Request) {
+	if s.PrivateSumDB == nil {
+		http.Error(w, "The private checksum database is not enabled", http.StatusNotFound)
+		return
+	}
+	http.StripPrefix("/sumdb", s.privateSumDBHandler()).ServeHTTP(w, req)
+}
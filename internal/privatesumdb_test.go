@@ -0,0 +1,219 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func newTestSigner(t *testing.T) (note.Signer, string) {
+	t.Helper()
+	skey, vkey, err := note.GenerateKey(rand.Reader, "sumdb.depproxy.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer, vkey
+}
+
+func TestPrivateSumDB(t *testing.T) {
+	files := map[string][]byte{
+		"example.com/m/@v/v1.0.0.mod": []byte("module example.com/m\n"),
+		"example.com/m/@v/v1.0.0.zip": makeTestZip(t, "example.com/m@v1.0.0/m.go"),
+		"example.com/m/@v/v1.1.0.mod": []byte("module example.com/m\n"),
+		"example.com/m/@v/v1.1.0.zip": makeTestZip(t, "example.com/m@v1.1.0/m.go"),
+		"example.com/m/@v/v1.2.0.mod": []byte("module example.com/m\n"),
+		"example.com/m/@v/v1.2.0.zip": makeTestZip(t, "example.com/m@v1.2.0/m.go"),
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if content, ok := files[strings.TrimPrefix(req.URL.Path, "/")]; ok {
+			w.Write(content)
+		} else {
+			http.NotFound(w, req)
+		}
+	}))
+	defer upstream.Close()
+
+	signer, verifier := newTestSigner(t)
+	dir := t.TempDir()
+	db, err := OpenPrivateSumDB(dir, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, upstream.URL, "example.com/m v1.0.0\nexample.com/m v1.2.0\n")
+	s.PrivateSumDB = db
+	depproxy := httptest.NewServer(s.HTTPHandler())
+	defer depproxy.Close()
+
+	// the client verifies the signed tree heads and proofs served by the private checksum
+	// database, and remembers the latest tree head in its directory, so it detects if the log
+	// is ever rewritten
+	sumDBURL, _ := url.Parse(depproxy.URL + "/sumdb")
+	clientServer := &Server{SumDB: &SumDB{Name: db.Name(), Key: verifier, URL: sumDBURL}}
+	client := sumdb.NewClient(&sumDBClientOps{server: clientServer, dir: t.TempDir()})
+
+	wantLines := func(version string) []string {
+		zipHash, _ := hashZipBytes(files["example.com/m/@v/"+version+".zip"])
+		goModHash, _ := hashGoMod(files["example.com/m/@v/"+version+".mod"])
+		return []string{"example.com/m " + version + " " + zipHash, "example.com/m " + version + "/go.mod " + goModHash}
+	}
+	// Lookup returns only the line for the requested file: the zip file, or the go.mod file if the
+	// version ends in /go.mod
+	lookup := func(version string, wantErr bool) {
+		t.Helper()
+		lines, err := client.Lookup("example.com/m", version)
+		if wantErr {
+			if err == nil {
+				t.Errorf("Lookup(%s) succeeded, want error", version)
+			}
+			return
+		}
+		if err != nil {
+			t.Errorf("Lookup(%s) failed: %s", version, err)
+		} else if want := wantLines(version)[:1]; !slices.Equal(lines, want) {
+			t.Errorf("Lookup(%s) = %q, want %q", version, lines, want)
+		}
+	}
+
+	lookup("v1.0.0", false)
+	lookup("v1.1.0", true) // not allowed
+	lookup("v1.0.0", false)
+	if n := len(db.records); n != 1 {
+		t.Errorf("private checksum database has %d records, want 1", n)
+	}
+
+	// the go.mod lookup is answered from the same record
+	if lines, err := client.Lookup("example.com/m", "v1.0.0/go.mod"); err != nil || !slices.Equal(lines, wantLines("v1.0.0")[1:]) {
+		t.Errorf("Lookup(v1.0.0/go.mod) = %q, %v; want %q", lines, err, wantLines("v1.0.0")[1:])
+	}
+
+	// reopening the database recomputes the same log, which the client verifies is consistent
+	// with the tree head it saw before
+	signed, err := db.signed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.PrivateSumDB, err = OpenPrivateSumDB(dir, signer); err != nil {
+		t.Fatal(err)
+	}
+	if reopenedSigned, err := s.PrivateSumDB.signed(); err != nil || string(reopenedSigned) != string(signed) {
+		t.Errorf("reopened database has signed tree head %q, %v; want %q", reopenedSigned, err, signed)
+	}
+	lookup("v1.2.0", false)
+	if n := len(s.PrivateSumDB.records); n != 2 {
+		t.Errorf("private checksum database has %d records, want 2", n)
+	}
+
+	// the private checksum database is also served through the checksum database proxy
+	if rec := serveTestRequest(s, "/proxy/sumdb/"+db.Name()+"/supported"); rec.Code != http.StatusOK {
+		t.Errorf("supported returned status %d", rec.Code)
+	}
+	if rec := serveTestRequest(s, "/proxy/sumdb/"+db.Name()+"/lookup/example.com/m@v1.0.0"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), wantLines("v1.0.0")[0]) {
+		t.Errorf("lookup through proxy returned %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestOpenPrivateSumDBRecovery(t *testing.T) {
+	signer, _ := newTestSigner(t)
+	tests := []struct {
+		name        string
+		appended    string
+		wantRecords int
+		wantErr     bool
+	}{
+		{name: "intact", appended: "", wantRecords: 2},
+		{name: "incomplete record", appended: "example.com/c v1.0.0 " + testHash + "\n", wantRecords: 2},
+		{name: "malformed record", appended: "example.com/c\n\n", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			db, err := OpenPrivateSumDB(dir, signer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, path := range []string{"example.com/a", "example.com/b"} {
+				if _, err := db.add(module.Version{Path: path, Version: "v1.0.0"}, testHash, testHash); err != nil {
+					t.Fatal(err)
+				}
+			}
+			signed, err := db.signed()
+			if err != nil {
+				t.Fatal(err)
+			}
+			recordsFile := filepath.Join(dir, "records")
+			intact, err := os.ReadFile(recordsFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(recordsFile, append(intact, test.appended...), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			db, err = OpenPrivateSumDB(dir, signer)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("OpenPrivateSumDB succeeded, want error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if len(db.records) != test.wantRecords {
+				t.Errorf("reopened database has %d records, want %d", len(db.records), test.wantRecords)
+			}
+			if reopenedSigned, err := db.signed(); err != nil || string(reopenedSigned) != string(signed) {
+				t.Errorf("reopened database has signed tree head %q, %v; want %q", reopenedSigned, err, signed)
+			}
+			if content, err := os.ReadFile(recordsFile); err != nil || string(content) != string(intact) {
+				t.Errorf("records file was not truncated to the intact records")
+			}
+
+			// new records are appended after the intact records
+			if id, err := db.add(module.Version{Path: "example.com/c", Version: "v1.0.0"}, testHash, testHash); err != nil || id != 2 {
+				t.Errorf("add returned %d, %v; want 2", id, err)
+			}
+			if db, err = OpenPrivateSumDB(dir, signer); err != nil || len(db.records) != 3 {
+				t.Errorf("after adding a record, reopening returned %v", err)
+			}
+		})
+	}
+}
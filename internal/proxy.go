@@ -32,19 +32,22 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
+
+	"golang.org/x/mod/semver"
 
 	"src.agwa.name/depproxy/internal/goproxy"
 )
 
 func (s *Server) requestListFromUpstream(ctx context.Context, module goproxy.ModulePath) ([]goproxy.ModuleVersion, error) {
-	resp, err := s.requestUpstream(ctx, module, goproxy.ListRequest{})
+	body, err := s.requestUpstream(ctx, module, goproxy.ListRequest{})
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	defer body.Close()
 
 	versions := []goproxy.ModuleVersion{}
-	scanner := bufio.NewScanner(resp.Body)
+	scanner := bufio.NewScanner(body)
 	for scanner.Scan() {
 		version, err := goproxy.MakeModuleVersion(scanner.Text())
 		if err != nil {
@@ -58,15 +61,79 @@ func (s *Server) requestListFromUpstream(ctx context.Context, module goproxy.Mod
 	return versions, nil
 }
 
-func (s *Server) serveLatestRequest(ctx context.Context, w http.ResponseWriter, module goproxy.ModulePath) {
-	allowedModule := s.getAllowedModule(module)
-	if allowedModule == nil {
+// latestVersion returns the highest release version in versions, or if there is no
+// release version, the highest prerelease version (including pseudo-versions), or the
+// empty version if versions is empty.  This mirrors how the go command chooses the latest
+// version of a module.
+func latestVersion(versions []goproxy.ModuleVersion) goproxy.ModuleVersion {
+	var latestRelease, latestPrerelease goproxy.ModuleVersion
+	for _, version := range versions {
+		if semver.Prerelease(version.String()) == "" {
+			if latestRelease.IsEmpty() || version.Compare(latestRelease) > 0 {
+				latestRelease = version
+			}
+		} else {
+			if latestPrerelease.IsEmpty() || version.Compare(latestPrerelease) > 0 {
+				latestPrerelease = version
+			}
+		}
+	}
+	if latestRelease.IsSet() {
+		return latestRelease
+	}
+	return latestPrerelease
+}
+
+// filterAllowedVersions returns the versions which are allowed by the allowlist rules,
+// which are not retracted (if retracted versions are blocked), and which are old enough.
+// It returns an error if retracted versions are blocked but can't be determined.
+func (s *Server) filterAllowedVersions(ctx context.Context, rules *pathRules, module goproxy.ModulePath, versions []goproxy.ModuleVersion) ([]goproxy.ModuleVersion, error) {
+	allowed := []goproxy.ModuleVersion{}
+	for _, version := range versions {
+		if rules.isAllowed(version) {
+			allowed = append(allowed, version)
+		}
+	}
+	allowed, err := s.filterRetracted(ctx, module, allowed)
+	if err != nil {
+		return nil, err
+	}
+	return s.filterByMinAge(ctx, rules, module, allowed), nil
+}
+
+func (s *Server) serveLatestRequest(w http.ResponseWriter, httpReq *http.Request, module goproxy.ModulePath) {
+	ctx := httpReq.Context()
+	rules := s.getAllowlist().rules(module)
+	if rules.allow.isEmpty() || rules.deny.all {
+		s.recordDenial(httpReq, module, "")
+		recordPolicy(w, policyAllowlist)
 		http.Error(w, fmt.Sprintf("Module %q is not allowed", module), http.StatusForbidden)
-	} else if allowedModule.Version.IsEmpty() {
-		s.redirectUpstream(w, module, goproxy.LatestRequest{})
-	} else {
-		s.redirectUpstream(w, module, goproxy.InfoRequest{Version: allowedModule.Version})
+		return
+	} else if rules.allow.all && rules.deny.isEmpty() && !rules.hasMinAge(s.MinAge) && !s.BlockRetracted {
+		s.serveUpstreamFile(ctx, w, module, goproxy.LatestRequest{})
+		return
+	}
+
+	versions, err := s.requestListFromUpstream(ctx, module)
+	if err != nil && !errors.Is(err, errNotFound) {
+		http.Error(w, "Error communicating with upstream proxy: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	// Pinned versions are candidates even if they aren't in the upstream list,
+	// since pseudo-versions are never listed
+	versions = append(versions, rules.pinned...)
+
+	allowed, err := s.filterAllowedVersions(ctx, rules, module, versions)
+	if err != nil {
+		http.Error(w, "Error determining retracted versions: "+err.Error(), http.StatusBadGateway)
+		return
 	}
+	latest := latestVersion(allowed)
+	if latest.IsEmpty() {
+		http.Error(w, fmt.Sprintf("No allowed version of module %q found at upstream proxy", module), http.StatusNotFound)
+		return
+	}
+	s.serveUpstreamFile(ctx, w, module, goproxy.InfoRequest{Version: latest})
 }
 
 func (s *Server) serveListRequest(ctx context.Context, w http.ResponseWriter, module goproxy.ModulePath) {
@@ -79,21 +146,143 @@ func (s *Server) serveListRequest(ctx context.Context, w http.ResponseWriter, mo
 		return
 	}
 
+	versions, err = s.filterAllowedVersions(ctx, s.getAllowlist().rules(module), module, versions)
+	if err != nil {
+		http.Error(w, "Error determining retracted versions: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
 	w.Header().Set("X-Content-Type-Options", "nosniff")
 	w.WriteHeader(http.StatusOK)
 
 	for _, version := range versions {
-		if s.isModuleAllowed(module, version) {
-			fmt.Fprintln(w, version)
+		fmt.Fprintln(w, version)
+	}
+}
+
+// A versionError explains why a module version must not be served
+type versionError struct {
+	status  int
+	message string
+	policy  string // if the version is denied by a policy, the policy (see recordPolicy)
+}
+
+func (err *versionError) Error() string {
+	return err.message
+}
+
+// checkVersionPolicies returns a non-nil *versionError if the given version of module is allowed
+// by the allowlist but must not be served anyway, because it has been retracted (and retracted
+// versions are blocked), its license is not allowed, or it is too new
+func (s *Server) checkVersionPolicies(ctx context.Context, rules *pathRules, module goproxy.ModulePath, version goproxy.ModuleVersion) *versionError {
+	if s.BlockRetracted {
+		retractions, err := s.getRetractions(ctx, module)
+		if err != nil {
+			return &versionError{http.StatusBadGateway, "Error determining retracted versions: " + err.Error(), ""}
+		}
+		if retraction := findRetraction(retractions, version); retraction != nil {
+			message := fmt.Sprintf("Version %q of module %q has been retracted by its author", version, module)
+			if retraction.Rationale != "" {
+				message += ": " + retraction.Rationale
+			}
+			return &versionError{http.StatusForbidden, message, policyRetraction}
+		}
+	}
+
+	if s.LicensePolicy != nil {
+		licenses, err := s.getModuleLicenses(ctx, module, version)
+		if errors.Is(err, errNotFound) {
+			return &versionError{http.StatusNotFound, "Module version not found at upstream proxy", ""}
+		} else if err != nil {
+			return &versionError{http.StatusBadGateway, "Error determining license of module version: " + err.Error(), ""}
+		}
+		if license := s.LicensePolicy.check(licenses); license != "" {
+			return &versionError{http.StatusForbidden, fmt.Sprintf("Version %q of module %q is licensed under %s, which is not allowed", version, module, license), policyLicense}
+		}
+	}
+
+	eligibleTime, err := s.getEligibleTime(ctx, rules, module, version)
+	if errors.Is(err, errNotFound) {
+		return &versionError{http.StatusNotFound, "Module version not found at upstream proxy", ""}
+	} else if err != nil {
+		return &versionError{http.StatusBadGateway, "Error determining age of module version: " + err.Error(), ""}
+	} else if eligibleTime.After(time.Now()) {
+		return &versionError{http.StatusForbidden, fmt.Sprintf("Version %q of module %q is too new; it will be allowed after %s", version, module, eligibleTime.UTC().Format(time.RFC3339)), policyMinAge}
+	}
+
+	return nil
+}
+
+func (s *Server) serveZipRequest(w http.ResponseWriter, httpReq *http.Request, module goproxy.ModulePath, request goproxy.ZipRequest) {
+	ctx := httpReq.Context()
+	rules := s.getAllowlist().rules(module)
+	if !rules.isAllowed(request.Version) {
+		s.recordDenial(httpReq, module, request.Version)
+		recordPolicy(w, policyAllowlist)
+		http.Error(w, fmt.Sprintf("Version %q of module %q is not allowed", request.Version, module), http.StatusForbidden)
+		return
+	}
+
+	if err := s.checkVersionPolicies(ctx, rules, module, request.Version); err != nil {
+		recordPolicy(w, err.policy)
+		http.Error(w, err.message, err.status)
+		return
+	}
+
+	s.serveUpstreamFile(ctx, w, module, request)
+}
+
+func requestContentType(req goproxy.Request) string {
+	switch req.(type) {
+	case goproxy.LatestRequest, goproxy.InfoRequest:
+		return "application/json"
+	case goproxy.ZipRequest:
+		return "application/zip"
+	default:
+		return "text/plain; charset=UTF-8"
+	}
+}
+
+func serveContent(w http.ResponseWriter, req goproxy.Request, content []byte) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", requestContentType(req))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write(content)
+}
+
+// serveUpstreamFile serves the file for req from the upstream proxy.  Normally, the client
+// is redirected to the upstream proxy.  However, if the file must be verified, if caching mode is
+// enabled, or if the client can't be redirected (see redirectableUpstream), the file is fetched by
+// depproxy (from the cache if possible) and served directly.  Serving verified content directly, rather than
+// redirecting the client, ensures that the client receives exactly the bytes that were verified.
+func (s *Server) serveUpstreamFile(ctx context.Context, w http.ResponseWriter, module goproxy.ModulePath, req goproxy.Request) {
+	if !s.needsVerification(module, req) && s.CacheDir == "" {
+		if upstreamURL := s.redirectableUpstream(module); upstreamURL != nil {
+			redirectUpstream(w, upstreamURL, module, req)
+			return
 		}
 	}
+	content, err := s.fetchVerifiedFile(ctx, module, req)
+	var verifyErr *verificationError
+	if errors.As(err, &verifyErr) {
+		http.Error(w, "Verification failed: "+verifyErr.Error(), http.StatusBadGateway)
+		return
+	} else if errors.Is(err, errNotFound) {
+		http.Error(w, "Module version not found at upstream proxy", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Error fetching file from upstream proxy: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	serveContent(w, req, content)
 }
 
 func (s *Server) serveProxyRequest(w http.ResponseWriter, httpReq *http.Request) {
 	if strings.HasPrefix(httpReq.URL.Path, "/proxy/sumdb/") {
-		http.Error(w, "sumdb is not proxied", http.StatusNotFound)
+		s.serveSumDBRequest(w, httpReq)
 		return
 	}
 	module, request, err := goproxy.ParseRequestPath(strings.TrimPrefix(httpReq.URL.Path, "/proxy/"))
@@ -101,21 +290,20 @@ func (s *Server) serveProxyRequest(w http.ResponseWriter, httpReq *http.Request)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	auditWriter := &auditResponseWriter{ResponseWriter: w}
+	defer s.finishProxyRequest(httpReq, auditWriter, module, request)
+	w = auditWriter
 	switch request := request.(type) {
 	case goproxy.LatestRequest:
-		s.serveLatestRequest(httpReq.Context(), w, module)
+		s.serveLatestRequest(w, httpReq, module)
 	case goproxy.ListRequest:
 		s.serveListRequest(httpReq.Context(), w, module)
 	case goproxy.InfoRequest:
-		s.redirectUpstream(w, module, request)
+		s.serveUpstreamFile(httpReq.Context(), w, module, request)
 	case goproxy.ModRequest:
-		s.redirectUpstream(w, module, request)
+		s.serveUpstreamFile(httpReq.Context(), w, module, request)
 	case goproxy.ZipRequest:
-		if s.isModuleAllowed(module, request.Version) {
-			s.redirectUpstream(w, module, request)
-		} else {
-			http.Error(w, fmt.Sprintf("Version %q of module %q is not allowed", request.Version, module), http.StatusForbidden)
-		}
+		s.serveZipRequest(w, httpReq, module, request)
 	default:
 		http.Error(w, "Unsupported request", http.StatusBadRequest)
 	}
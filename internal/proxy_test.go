@@ -0,0 +1,188 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+// newTestUpstream returns a test server which serves the given list of versions for
+// every module, and an info file for every version
+func newTestUpstream(t *testing.T, versions ...string) *httptest.Server {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasSuffix(req.URL.Path, "/@v/list") {
+			io.WriteString(w, strings.Join(versions, "\n")+"\n")
+		} else if _, file, ok := strings.Cut(req.URL.Path, "/@v/"); ok && strings.HasSuffix(file, ".info") {
+			io.WriteString(w, `{"Version":"`+strings.TrimSuffix(file, ".info")+`","Time":"2020-01-01T00:00:00Z"}`)
+		} else {
+			http.NotFound(w, req)
+		}
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+func serveTestRequest(s *Server, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.HTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestServeListRequestDeny(t *testing.T) {
+	upstream := newTestUpstream(t, "v1.1.49", "v1.1.50", "v1.1.51", "v1.2.0")
+	s := newTestServer(t, upstream.URL, `
+example.com/* *
+!example.com/evil *
+!example.com/dns v1.1.50
+!example.com/dns >=v1.2.0
+`)
+	tests := []struct {
+		module     string
+		wantStatus int
+		wantBody   string
+	}{
+		{"example.com/good", http.StatusOK, "v1.1.49\nv1.1.50\nv1.1.51\nv1.2.0\n"},
+		{"example.com/dns", http.StatusOK, "v1.1.49\nv1.1.51\n"},
+		{"example.com/evil", http.StatusOK, ""},
+	}
+	for _, test := range tests {
+		rec := serveTestRequest(s, "/proxy/"+test.module+"/@v/list")
+		if rec.Code != test.wantStatus || rec.Body.String() != test.wantBody {
+			t.Errorf("list of %s returned %d %q, want %d %q", test.module, rec.Code, rec.Body.String(), test.wantStatus, test.wantBody)
+		}
+	}
+}
+
+func TestServeLatestRequestDeny(t *testing.T) {
+	upstream := newTestUpstream(t, "v1.1.49", "v1.1.50", "v1.1.51", "v1.2.0")
+	s := newTestServer(t, upstream.URL, `
+example.com/* *
+!example.com/evil *
+!example.com/dns >=v1.1.50
+`)
+	tests := []struct {
+		module       string
+		wantStatus   int
+		wantLocation string
+	}{
+		{"example.com/good", http.StatusSeeOther, upstream.URL + "/example.com/good/@latest"},
+		{"example.com/dns", http.StatusSeeOther, upstream.URL + "/example.com/dns/@v/v1.1.49.info"},
+		{"example.com/evil", http.StatusForbidden, ""},
+	}
+	for _, test := range tests {
+		rec := serveTestRequest(s, "/proxy/"+test.module+"/@latest")
+		if location := rec.Header().Get("Location"); rec.Code != test.wantStatus || location != test.wantLocation {
+			t.Errorf("@latest of %s returned %d %q, want %d %q", test.module, rec.Code, location, test.wantStatus, test.wantLocation)
+		}
+	}
+}
+
+func TestServePatternVersionConstraint(t *testing.T) {
+	upstream := newTestUpstream(t, "v0.19.0", "v0.20.0", "v0.21.0-rc.1", "v0.21.0", "v1.0.0")
+	s := newTestServer(t, upstream.URL, `
+golang.org/x/* >=v0.20.0 <v1.0.0
+github.com/aws/* v1.*
+`)
+	tests := []struct {
+		module       string
+		wantList     string
+		wantLocation string
+	}{
+		{"golang.org/x/mod", "v0.20.0\nv0.21.0\n", upstream.URL + "/golang.org/x/mod/@v/v0.21.0.info"},
+		{"github.com/aws/sdk", "v1.0.0\n", upstream.URL + "/github.com/aws/sdk/@v/v1.0.0.info"},
+	}
+	for _, test := range tests {
+		if rec := serveTestRequest(s, "/proxy/"+test.module+"/@v/list"); rec.Body.String() != test.wantList {
+			t.Errorf("list of %s returned %q, want %q", test.module, rec.Body.String(), test.wantList)
+		}
+		if rec := serveTestRequest(s, "/proxy/"+test.module+"/@latest"); rec.Header().Get("Location") != test.wantLocation {
+			t.Errorf("@latest of %s redirected to %q, want %q", test.module, rec.Header().Get("Location"), test.wantLocation)
+		}
+	}
+	for _, path := range []string{"/proxy/golang.org/x/mod/@v/v0.19.0.zip", "/proxy/golang.org/x/mod/@v/v1.0.0.zip", "/proxy/github.com/aws/sdk/@v/v0.21.0.zip"} {
+		if rec := serveTestRequest(s, path); rec.Code != http.StatusForbidden {
+			t.Errorf("GET %s returned status %d, want %d", path, rec.Code, http.StatusForbidden)
+		}
+	}
+}
+
+func TestLatestVersion(t *testing.T) {
+	tests := []struct {
+		versions []goproxy.ModuleVersion
+		want     goproxy.ModuleVersion
+	}{
+		{nil, ""},
+		{[]goproxy.ModuleVersion{"v1.1.51", "v1.1.52", "v1.1.9"}, "v1.1.52"},
+		{[]goproxy.ModuleVersion{"v1.2.0-rc.1", "v1.1.0"}, "v1.1.0"},
+		{[]goproxy.ModuleVersion{"v1.2.0-rc.1", "v1.2.0-beta.2"}, "v1.2.0-rc.1"},
+		{[]goproxy.ModuleVersion{"v0.0.0-20240102030405-abcdefabcdef", "v0.1.0"}, "v0.1.0"},
+		{[]goproxy.ModuleVersion{"v2.0.0+incompatible", "v1.9.0"}, "v2.0.0+incompatible"},
+	}
+	for _, test := range tests {
+		if got := latestVersion(test.versions); got != test.want {
+			t.Errorf("latestVersion(%v) = %q, want %q", test.versions, got, test.want)
+		}
+	}
+}
+
+func TestServeLatestRequest(t *testing.T) {
+	upstream := newTestUpstream(t, "v1.1.50", "v1.1.51", "v1.1.52", "v1.2.0")
+	s := newTestServer(t, upstream.URL, `
+example.com/dns v1.1.51
+example.com/dns v1.1.52
+example.com/pattern/* v1.1.*
+example.com/pattern/pinned v1.2.0
+example.com/pseudo v1.1.53-0.20240102030405-abcdefabcdef
+example.com/all *
+example.com/missing v3.*
+`)
+	tests := []struct {
+		module       string
+		wantStatus   int
+		wantLocation string
+	}{
+		{"example.com/dns", http.StatusSeeOther, upstream.URL + "/example.com/dns/@v/v1.1.52.info"},
+		{"example.com/pattern/other", http.StatusSeeOther, upstream.URL + "/example.com/pattern/other/@v/v1.1.52.info"},
+		{"example.com/pattern/pinned", http.StatusSeeOther, upstream.URL + "/example.com/pattern/pinned/@v/v1.2.0.info"},
+		{"example.com/pseudo", http.StatusSeeOther, upstream.URL + "/example.com/pseudo/@v/v1.1.53-0.20240102030405-abcdefabcdef.info"},
+		{"example.com/all", http.StatusSeeOther, upstream.URL + "/example.com/all/@latest"},
+		{"example.com/missing", http.StatusNotFound, ""},
+		{"example.com/unlisted", http.StatusForbidden, ""},
+	}
+	for _, test := range tests {
+		rec := serveTestRequest(s, "/proxy/"+test.module+"/@latest")
+		if location := rec.Header().Get("Location"); rec.Code != test.wantStatus || location != test.wantLocation {
+			t.Errorf("@latest of %s returned %d %q, want %d %q", test.module, rec.Code, location, test.wantStatus, test.wantLocation)
+		}
+	}
+}
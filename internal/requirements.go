@@ -0,0 +1,208 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/sync/errgroup"
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+var requirementsTemplate = template.Must(template.ParseFS(content, "templates/requirements.html"))
+
+type moduleVersion struct {
+	Path    goproxy.ModulePath
+	Version goproxy.ModuleVersion
+}
+
+func (mv moduleVersion) String() string {
+	return mv.Path.String() + "@" + mv.Version.String()
+}
+
+// requirementsReport lists the modules selected by minimal version selection, starting
+// from a pinned allowlist entry, which the allowlist does not allow
+type requirementsReport struct {
+	Path       goproxy.ModulePath
+	Version    goproxy.ModuleVersion
+	Disallowed []disallowedRequirement
+	Error      string `json:",omitempty"`
+}
+
+type disallowedRequirement struct {
+	Path       goproxy.ModulePath
+	Version    goproxy.ModuleVersion
+	RequiredBy []string // module@version of each module whose go.mod file requires exactly this version
+}
+
+// getModRequirements returns the requirements listed in the go.mod file of the given
+// module version.  Since this never changes, it is cached.
+func (s *Server) getModRequirements(ctx context.Context, mv moduleVersion) ([]moduleVersion, error) {
+	key := mv.String()
+	if requirements, ok := s.modRequirements.Load(key); ok {
+		return requirements.([]moduleVersion), nil
+	}
+	goMod, err := s.downloadUpstreamFile(ctx, mv.Path, goproxy.ModRequest{Version: mv.Version})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", mv, err)
+	}
+	file, err := modfile.ParseLax(key+"/go.mod", goMod, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing go.mod file: %w", err)
+	}
+	requirements := make([]moduleVersion, 0, len(file.Require))
+	for _, require := range file.Require {
+		path, err := goproxy.MakeModulePath(require.Mod.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%s/go.mod: %w", mv, err)
+		}
+		version, err := goproxy.MakeModuleVersion(require.Mod.Version)
+		if err != nil {
+			return nil, fmt.Errorf("%s/go.mod: %w", mv, err)
+		}
+		requirements = append(requirements, moduleVersion{Path: path, Version: version})
+	}
+	s.modRequirements.Store(key, requirements)
+	return requirements, nil
+}
+
+// buildList runs minimal version selection on the requirement graph rooted at the
+// given module version.  It returns the selected version of every module in the graph,
+// along with the modules which require each module version.  Like the go command
+// when the root is a dependency, it ignores replace and exclude directives.
+func (s *Server) buildList(ctx context.Context, root moduleVersion) (map[goproxy.ModulePath]goproxy.ModuleVersion, map[moduleVersion][]moduleVersion, error) {
+	selected := map[goproxy.ModulePath]goproxy.ModuleVersion{root.Path: root.Version}
+	requiredBy := make(map[moduleVersion][]moduleVersion)
+	visited := map[moduleVersion]bool{root: true}
+
+	queue := []moduleVersion{root}
+	for len(queue) > 0 {
+		requirements := make([][]moduleVersion, len(queue))
+		group, groupCtx := errgroup.WithContext(ctx)
+		group.SetLimit(10)
+		for i, mv := range queue {
+			group.Go(func() (err error) {
+				requirements[i], err = s.getModRequirements(groupCtx, mv)
+				return err
+			})
+		}
+		if err := group.Wait(); err != nil {
+			return nil, nil, err
+		}
+
+		var next []moduleVersion
+		for i, mv := range queue {
+			for _, req := range requirements[i] {
+				requiredBy[req] = append(requiredBy[req], mv)
+				if current, ok := selected[req.Path]; !ok || current.Compare(req.Version) < 0 {
+					selected[req.Path] = req.Version
+				}
+				if !visited[req] {
+					visited[req] = true
+					next = append(next, req)
+				}
+			}
+		}
+		queue = next
+	}
+	return selected, requiredBy, nil
+}
+
+func (s *Server) getRequirementsReport(ctx context.Context, root moduleVersion) requirementsReport {
+	report := requirementsReport{Path: root.Path, Version: root.Version, Disallowed: []disallowedRequirement{}}
+	selected, requiredBy, err := s.buildList(ctx, root)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	for path, version := range selected {
+		if s.isModuleAllowed(path, version) {
+			continue
+		}
+		mv := moduleVersion{Path: path, Version: version}
+		requirement := disallowedRequirement{Path: path, Version: version, RequiredBy: []string{}}
+		for _, parent := range requiredBy[mv] {
+			requirement.RequiredBy = append(requirement.RequiredBy, parent.String())
+		}
+		slices.Sort(requirement.RequiredBy)
+		report.Disallowed = append(report.Disallowed, requirement)
+	}
+	slices.SortFunc(report.Disallowed, func(a, b disallowedRequirement) int {
+		return cmp.Compare(a.Path, b.Path)
+	})
+	return report
+}
+
+// getRequirementsReports returns a report for every exact module version in the allowlist
+func (s *Server) getRequirementsReports(ctx context.Context) []requirementsReport {
+	var roots []moduleVersion
+	for _, module := range s.getAllowedModules() {
+		if module.Deny || module.Path.IsEmpty() || module.Version.IsEmpty() {
+			continue
+		}
+		root := moduleVersion{Path: module.Path, Version: module.Version}
+		if !slices.Contains(roots, root) {
+			roots = append(roots, root)
+		}
+	}
+
+	reports := make([]requirementsReport, len(roots))
+	var group errgroup.Group
+	group.SetLimit(4) // each report fetches up to 10 go.mod files concurrently (see buildList)
+	for i, root := range roots {
+		group.Go(func() error {
+			reports[i] = s.getRequirementsReport(ctx, root)
+			return nil
+		})
+	}
+	group.Wait()
+	return reports
+}
+
+func (s *Server) serveRequirements(w http.ResponseWriter, req *http.Request) {
+	reports := s.getRequirementsReports(req.Context())
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(reports)
+}
+
+func (s *Server) serveRequirementsHTML(w http.ResponseWriter, req *http.Request) {
+	reports := s.getRequirementsReports(req.Context())
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Xss-Protection", "0")
+	w.WriteHeader(http.StatusOK)
+	requirementsTemplate.Execute(w, reports)
+}
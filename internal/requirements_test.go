@@ -0,0 +1,93 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetRequirementsReports(t *testing.T) {
+	goMods := map[string]string{
+		"example.com/app@v1.0.0": "module example.com/app\n\nrequire (\n\texample.com/a v1.1.0\n\texample.com/b v1.0.0\n)\n\nreplace example.com/a => example.com/fork v1.0.0\n",
+		"example.com/a@v1.0.0":   "module example.com/a\n\nrequire example.com/e v1.0.0\n",
+		"example.com/a@v1.1.0":   "module example.com/a\n\nrequire example.com/c v1.0.0\n",
+		"example.com/b@v1.0.0":   "module example.com/b\n\nrequire (\n\texample.com/c v1.2.0\n\texample.com/d v0.1.0\n)\n",
+		"example.com/c@v1.0.0":   "module example.com/c\n",
+		"example.com/c@v1.2.0":   "module example.com/c\n",
+		"example.com/d@v0.1.0":   "module example.com/d\n\nrequire example.com/a v1.0.0\n",
+		"example.com/e@v1.0.0":   "module example.com/e\n",
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		module, file, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/"), "/@v/")
+		version, _ := strings.CutSuffix(file, ".mod")
+		if goMod, ok := goMods[module+"@"+version]; ok {
+			w.Write([]byte(goMod))
+		} else {
+			http.NotFound(w, req)
+		}
+	}))
+	defer upstream.Close()
+
+	s := newTestServer(t, upstream.URL, `
+example.com/app v1.0.0
+example.com/a *
+example.com/b *
+example.com/c v1.0.0
+example.com/missing v1.0.0
+example.com/wildcard *
+`)
+	want := []requirementsReport{
+		{
+			Path:    "example.com/app",
+			Version: "v1.0.0",
+			Disallowed: []disallowedRequirement{
+				{Path: "example.com/c", Version: "v1.2.0", RequiredBy: []string{"example.com/b@v1.0.0"}},
+				{Path: "example.com/d", Version: "v0.1.0", RequiredBy: []string{"example.com/b@v1.0.0"}},
+				{Path: "example.com/e", Version: "v1.0.0", RequiredBy: []string{"example.com/a@v1.0.0"}},
+			},
+		},
+		{
+			Path:       "example.com/c",
+			Version:    "v1.0.0",
+			Disallowed: []disallowedRequirement{},
+		},
+		{
+			Path:       "example.com/missing",
+			Version:    "v1.0.0",
+			Disallowed: []disallowedRequirement{},
+			Error:      "example.com/missing@v1.0.0: error communicating with upstream proxy: not found",
+		},
+	}
+	got := s.getRequirementsReports(context.Background())
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getRequirementsReports returned:\n%+v\nwant:\n%+v", got, want)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/mod/modfile"
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+// How long to cache a module's retractions before fetching its latest go.mod file again
+const retractionsCacheDuration = 10 * time.Minute
+
+type Retraction struct {
+	Low       goproxy.ModuleVersion
+	High      goproxy.ModuleVersion
+	Rationale string
+}
+
+type cachedRetractions struct {
+	retractions []Retraction
+	expires     time.Time
+}
+
+// findRetraction returns the retraction which covers version, or nil if version is not retracted
+func findRetraction(retractions []Retraction, version goproxy.ModuleVersion) *Retraction {
+	for i := range retractions {
+		if version.Compare(retractions[i].Low) >= 0 && version.Compare(retractions[i].High) <= 0 {
+			return &retractions[i]
+		}
+	}
+	return nil
+}
+
+// getLatestVersion returns the latest version of the module at the upstream proxy,
+// regardless of whether it is allowed
+func (s *Server) getLatestVersion(ctx context.Context, module goproxy.ModulePath) (goproxy.ModuleVersion, error) {
+	versions, err := s.requestListFromUpstream(ctx, module)
+	if err != nil {
+		return "", err
+	}
+	if latest := latestVersion(versions); latest.IsSet() {
+		return latest, nil
+	}
+	info, err := s.getLatestModuleInfo(ctx, module)
+	if err != nil {
+		return "", err
+	}
+	return info.Version, nil
+}
+
+// getRetractions returns the versions retracted by the go.mod file of the latest version
+// of the module, which is where the go command looks for retractions
+func (s *Server) getRetractions(ctx context.Context, module goproxy.ModulePath) ([]Retraction, error) {
+	if cached, ok := s.retractions.Load(module); ok && time.Now().Before(cached.(*cachedRetractions).expires) {
+		return cached.(*cachedRetractions).retractions, nil
+	}
+
+	latest, err := s.getLatestVersion(ctx, module)
+	if errors.Is(err, errNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	goMod, err := s.downloadUpstreamFile(ctx, module, goproxy.ModRequest{Version: latest})
+	if err != nil {
+		return nil, err
+	}
+	file, err := modfile.ParseLax(module.String()+"@"+latest.String()+"/go.mod", goMod, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing go.mod file: %w", err)
+	}
+
+	retractions := make([]Retraction, 0, len(file.Retract))
+	for _, retract := range file.Retract {
+		retractions = append(retractions, Retraction{
+			Low:       goproxy.ModuleVersion(retract.Low),
+			High:      goproxy.ModuleVersion(retract.High),
+			Rationale: retract.Rationale,
+		})
+	}
+	s.retractions.Store(module, &cachedRetractions{
+		retractions: retractions,
+		expires:     time.Now().Add(retractionsCacheDuration),
+	})
+	return retractions, nil
+}
+
+// filterRetracted returns the versions which have not been retracted, if retracted versions
+// are blocked.  If retractions cannot be determined, an error is returned, just as
+// checkVersionPolicies refuses to serve a version whose retraction status is unknown.
+func (s *Server) filterRetracted(ctx context.Context, module goproxy.ModulePath, versions []goproxy.ModuleVersion) ([]goproxy.ModuleVersion, error) {
+	if !s.BlockRetracted || len(versions) == 0 {
+		return versions, nil
+	}
+	retractions, err := s.getRetractions(ctx, module)
+	if err != nil {
+		return nil, err
+	} else if len(retractions) == 0 {
+		return versions, nil
+	}
+	filtered := []goproxy.ModuleVersion{}
+	for _, version := range versions {
+		if findRetraction(retractions, version) == nil {
+			filtered = append(filtered, version)
+		}
+	}
+	return filtered, nil
+}
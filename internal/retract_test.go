@@ -0,0 +1,141 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+func TestFindRetraction(t *testing.T) {
+	retractions := []Retraction{
+		{Low: "v1.1.0", High: "v1.1.0", Rationale: "bad"},
+		{Low: "v1.2.0", High: "v1.2.9"},
+	}
+	tests := []struct {
+		version goproxy.ModuleVersion
+		want    *Retraction
+	}{
+		{"v1.0.0", nil},
+		{"v1.1.0", &retractions[0]},
+		{"v1.1.1", nil},
+		{"v1.2.0", &retractions[1]},
+		{"v1.2.5", &retractions[1]},
+		{"v1.2.9", &retractions[1]},
+		{"v1.2.10", nil},
+		{"v1.2.0-rc.1", nil},
+		{"v1.2.1-0.20240102030405-abcdefabcdef", &retractions[1]},
+	}
+	for _, test := range tests {
+		if got := findRetraction(retractions, test.version); got != test.want {
+			t.Errorf("findRetraction(%s) = %v, want %v", test.version, got, test.want)
+		}
+	}
+}
+
+func TestRetractionPolicy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/example.com/m/@v/list":
+			fmt.Fprint(w, "v1.0.0\nv1.1.0\nv1.2.0\nv1.2.1\nv1.3.0\n")
+		case "/example.com/m/@v/v1.3.0.mod":
+			fmt.Fprint(w, "module example.com/m\n\nretract v1.1.0 // contains a security bug\n\nretract [v1.2.0, v1.2.9]\n")
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer upstream.Close()
+
+	tests := []struct {
+		blockRetracted bool
+		wantList       string
+		wantZipStatus  map[string]int
+	}{
+		{
+			blockRetracted: true,
+			wantList:       "v1.0.0\nv1.3.0\n",
+			wantZipStatus: map[string]int{
+				"v1.0.0": http.StatusSeeOther,
+				"v1.1.0": http.StatusForbidden,
+				"v1.2.1": http.StatusForbidden,
+				"v1.3.0": http.StatusSeeOther,
+			},
+		},
+		{
+			blockRetracted: false,
+			wantList:       "v1.0.0\nv1.1.0\nv1.2.0\nv1.2.1\nv1.3.0\n",
+			wantZipStatus: map[string]int{
+				"v1.1.0": http.StatusSeeOther,
+				"v1.2.1": http.StatusSeeOther,
+			},
+		},
+	}
+	for _, test := range tests {
+		s := newTestServer(t, upstream.URL, "example.com/m *\n")
+		s.BlockRetracted = test.blockRetracted
+		if rec := serveTestRequest(s, "/proxy/example.com/m/@v/list"); rec.Body.String() != test.wantList {
+			t.Errorf("BlockRetracted=%v: list returned %q, want %q", test.blockRetracted, rec.Body.String(), test.wantList)
+		}
+		for version, wantStatus := range test.wantZipStatus {
+			if rec := serveTestRequest(s, "/proxy/example.com/m/@v/"+version+".zip"); rec.Code != wantStatus {
+				t.Errorf("BlockRetracted=%v: zip of %s returned status %d, want %d", test.blockRetracted, version, rec.Code, wantStatus)
+			}
+		}
+	}
+
+	s := newTestServer(t, upstream.URL, "example.com/m *\n")
+	s.BlockRetracted = true
+	if rec := serveTestRequest(s, "/proxy/example.com/m/@v/v1.1.0.zip"); !strings.Contains(rec.Body.String(), "contains a security bug") {
+		t.Errorf("denial of retracted version does not include rationale: %q", rec.Body.String())
+	}
+}
+
+func TestRetractionLookupFailure(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/example.com/m/@v/list":
+			fmt.Fprint(w, "v1.0.0\nv1.1.0\n")
+		case "/example.com/m/@v/v1.1.0.mod":
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer upstream.Close()
+
+	s := newTestServer(t, upstream.URL, "example.com/m *\n")
+	s.BlockRetracted = true
+	for _, path := range []string{"example.com/m/@v/list", "example.com/m/@latest", "example.com/m/@v/v1.0.0.zip"} {
+		if rec := serveTestRequest(s, "/proxy/"+path); rec.Code != http.StatusBadGateway {
+			t.Errorf("%s returned status %d, want %d", path, rec.Code, http.StatusBadGateway)
+		}
+	}
+}
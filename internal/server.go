@@ -26,12 +26,19 @@
 package depproxy
 
 import (
+	"bytes"
 	"context"
 	"embed"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"golang.org/x/mod/sumdb"
 	"src.agwa.name/depproxy/internal/goproxy"
 )
 
@@ -41,62 +48,179 @@ var content embed.FS
 var errNotFound = errors.New("not found")
 
 type Server struct {
-	UpstreamProxy  *url.URL
-	AllowedModules []AllowedModule
+	Upstreams        []*Upstream    // the first upstream whose patterns match a module is used for that module
+	MinAge           time.Duration  // versions published more recently than this are not allowed, unless overridden by the allowlist
+	BlockRetracted   bool           // if true, versions retracted by their module's author are not allowed
+	LicensePolicy    *LicensePolicy // if non-nil, versions whose licenses are not allowed by this policy are not allowed
+	AllowlistFile    string         // if set, versions approved in the web interface are saved to this allowlist file
+	Approvers        *Approvers     // users who may approve new versions in the web interface
+	AuditLog         io.Writer      // if non-nil, an audit record of every proxy request is written here in JSON Lines format
+	CacheDir         string         // if set, files of allowed versions are stored in this directory and served directly, instead of redirecting to the upstream proxy
+	SumDB            *SumDB         // if non-nil, this checksum database is proxied under /proxy/sumdb/
+	SumDBVerifierDir string         // if set, zip and go.mod files are verified against SumDB before being served or approved, and the verifier's state is stored in this directory
+	NoSumDB          string         // comma-separated module path patterns, in GONOSUMDB syntax, which are not verified against SumDB
+	PrivateSumDB     *PrivateSumDB  // if non-nil, this checksum database of served versions is served under /sumdb/
+	GitRewrites      []GitRewrite   // map module paths to git repository URLs for direct upstreams
+	GitDir           string         // directory in which to store clones of git repositories for direct upstreams
+
+	allowlist       atomic.Pointer[Allowlist]
+	retractions     sync.Map // goproxy.ModulePath -> *cachedRetractions
+	modRequirements sync.Map // module@version -> []moduleVersion
+
+	licensesMu sync.Mutex
+	licenses   map[string][]string // module@version -> SPDX identifiers of licenses
+
+	versionTimesMu sync.Mutex
+	versionTimes   map[string]*cachedVersionTime // module@version -> publication time
+
+	approveMu sync.Mutex // serializes changes to AllowlistFile
+
+	deniedMu sync.Mutex
+	denied   map[moduleVersion]*deniedRequest
+
+	auditMu sync.Mutex // serializes writes to AuditLog
+
+	metricsOnce sync.Once
+	metrics     *metrics
+
+	sumDBClientOnce sync.Once
+	sumDBClient     *sumdb.Client
+	sumDBFailuresMu sync.Mutex
+	sumDBFailures   []sumDBFailure
+
+	gitRepos sync.Map // git repository URL -> *gitRepo
 }
 
-func (s *Server) getAllowedModule(path goproxy.ModulePath) *AllowedModule {
-	for _, m := range s.AllowedModules {
-		if m.matchesPath(path) {
-			return &m
-		}
+// SetAllowedModules atomically replaces the server's allowlist.  It is safe
+// to call while the server is handling requests.
+func (s *Server) SetAllowedModules(modules []AllowedModule) {
+	s.allowlist.Store(CompileAllowlist(modules))
+	s.recordAllowlistLoad()
+}
+
+func (s *Server) getAllowlist() *Allowlist {
+	if allowlist := s.allowlist.Load(); allowlist != nil {
+		return allowlist
 	}
-	return nil
+	return CompileAllowlist(nil)
+}
+
+func (s *Server) getAllowedModules() []AllowedModule {
+	return s.getAllowlist().Modules()
 }
 
 func (s *Server) isModuleAllowed(path goproxy.ModulePath, version goproxy.ModuleVersion) bool {
-	for _, m := range s.AllowedModules {
-		if m.matches(path, version) {
-			return true
-		}
-	}
-	return false
+	return s.getAllowlist().IsAllowed(path, version)
 }
 
-func (s *Server) redirectUpstream(w http.ResponseWriter, module goproxy.ModulePath, req goproxy.Request) {
-	url := s.UpstreamProxy.JoinPath(module.Escaped(), req.Path())
+// getPinnedHashes returns the zip and go.mod hashes that the allowlist requires
+// for the given module version, or empty strings if no hash is required
+func (s *Server) getPinnedHashes(path goproxy.ModulePath, version goproxy.ModuleVersion) (zipHash string, goModHash string) {
+	return s.getAllowlist().pinnedHashes(path, version)
+}
+
+func redirectUpstream(w http.ResponseWriter, upstreamURL *url.URL, module goproxy.ModulePath, req goproxy.Request) {
+	url := upstreamURL.JoinPath(module.Escaped(), req.Path())
 	w.Header().Set("Location", url.String())
 	w.WriteHeader(http.StatusSeeOther)
 }
 
-func (s *Server) requestUpstream(ctx context.Context, module goproxy.ModulePath, req goproxy.Request) (*http.Response, error) {
-	url := s.UpstreamProxy.JoinPath(module.Escaped(), req.Path())
+// requestUpstream requests the file for req from the proxies of module's upstream in turn, until
+// one of them returns the file or returns an error which doesn't permit falling back to the next
+func (s *Server) requestUpstream(ctx context.Context, module goproxy.ModulePath, req goproxy.Request) (io.ReadCloser, error) {
+	upstream := s.getUpstream(module)
+	if upstream == nil {
+		return nil, fmt.Errorf("no upstream proxy is configured for %s: %w", module, errNotFound)
+	}
+	var err error
+	for i := range upstream.Proxies {
+		proxy := &upstream.Proxies[i]
+		var body io.ReadCloser
+		if proxy.Direct {
+			body, err = s.requestDirect(ctx, module, req)
+		} else {
+			body, err = s.requestUpstreamProxy(ctx, proxy, module, req)
+		}
+		if err == nil {
+			return body, nil
+		} else if !errors.Is(err, errNotFound) && !proxy.FallbackOnError {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+func (s *Server) requestDirect(ctx context.Context, module goproxy.ModulePath, req goproxy.Request) (io.ReadCloser, error) {
+	start := time.Now()
+	content, err := s.requestGitUpstream(ctx, module, req)
+	s.getMetrics().upstreamDuration.observeSince(start, requestType(req))
+	if errors.Is(err, errNotFound) {
+		s.getMetrics().upstreamRequests.inc(requestType(req), "not-found")
+		return nil, err
+	} else if err != nil {
+		s.getMetrics().upstreamRequests.inc(requestType(req), "error")
+		return nil, err
+	}
+	s.getMetrics().upstreamRequests.inc(requestType(req), "ok")
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+func (s *Server) requestUpstreamProxy(ctx context.Context, proxy *UpstreamProxy, module goproxy.ModulePath, req goproxy.Request) (io.ReadCloser, error) {
+	if isLocalUpstream(proxy.URL) {
+		body, err := openLocalUpstream(proxy.URL.Path, module, req)
+		if errors.Is(err, errNotFound) {
+			s.getMetrics().upstreamRequests.inc(requestType(req), "not-found")
+		} else if err != nil {
+			s.getMetrics().upstreamRequests.inc(requestType(req), "error")
+		} else {
+			s.getMetrics().upstreamRequests.inc(requestType(req), "ok")
+		}
+		return body, err
+	}
+
+	url := proxy.URL.JoinPath(module.Escaped(), req.Path())
 	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, url.String(), nil)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := http.DefaultClient.Do(httpReq)
+	if authorization := proxy.authorization(); authorization != "" {
+		httpReq.Header.Set("Authorization", authorization)
+	}
+	start := time.Now()
+	resp, err := proxy.client().Do(httpReq)
+	s.getMetrics().upstreamDuration.observeSince(start, requestType(req))
 	if err != nil {
+		s.getMetrics().upstreamRequests.inc(requestType(req), "error")
 		return nil, err
 	}
 	if resp.StatusCode == http.StatusOK {
-		return resp, nil
+		s.getMetrics().upstreamRequests.inc(requestType(req), "ok")
+		return resp.Body, nil
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		s.getMetrics().upstreamRequests.inc(requestType(req), "not-found")
 		return nil, errNotFound
 	} else {
-		return nil, errors.New(url.String() + ": " + resp.Status)
+		s.getMetrics().upstreamRequests.inc(requestType(req), "error")
+		return nil, errors.New(url.Redacted() + ": " + resp.Status)
 	}
 }
 
 func (s *Server) HTTPHandler() http.Handler {
 	mux := http.NewServeMux()
 	mux.Handle("/assets/", http.FileServer(http.FS(content)))
+	mux.HandleFunc("/approve", s.serveApprove)
+	mux.HandleFunc("/denied", s.serveDenied)
+	mux.HandleFunc("/denied.html", s.serveDeniedHTML)
 	mux.HandleFunc("/diff", s.serveDiff)
 	mux.HandleFunc("/diff.html", s.serveDiffHTML)
+	mux.HandleFunc("/metrics", s.serveMetrics)
 	mux.HandleFunc("/modules", s.serveModules)
+	mux.HandleFunc("/requirements", s.serveRequirements)
+	mux.HandleFunc("/requirements.html", s.serveRequirementsHTML)
 	mux.HandleFunc("/proxy/", s.serveProxyRequest)
+	mux.HandleFunc("/sumdb/", s.servePrivateSumDB)
 	mux.HandleFunc("/", s.serveDashboard)
 	return mux
 }
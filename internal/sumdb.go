@@ -0,0 +1,201 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// DefaultSumDB is the checksum database used by the go command by default, in GOSUMDB syntax
+const DefaultSumDB = "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ojem6gbXvh3MgHE4BLiHuOkh8"
+
+// Maximum size of a response from the checksum database
+const maxSumDBResponseSize = 1 << 20
+
+// Maximum time to wait for a response from the checksum database when verifying modules
+const sumDBRequestTimeout = 30 * time.Second
+
+// A SumDB is a checksum database
+type SumDB struct {
+	Name string   // name of the database, e.g. sum.golang.org
+	Key  string   // verifier key of the database, in golang.org/x/mod/sumdb/note format
+	URL  *url.URL // URL of the database
+}
+
+// ParseSumDB parses a checksum database specification in GOSUMDB syntax: a verifier key,
+// optionally followed by whitespace and the database's URL.  If the URL is omitted, it
+// defaults to https:// followed by the database name.
+func ParseSumDB(str string) (*SumDB, error) {
+	f := strings.Fields(str)
+	if len(f) == 0 || len(f) > 2 {
+		return nil, fmt.Errorf("checksum database must be specified as KEY or KEY URL")
+	}
+	name, _, found := strings.Cut(f[0], "+")
+	if !found || name == "" {
+		return nil, fmt.Errorf("checksum database key %q is malformed", f[0])
+	}
+	sumdb := &SumDB{Name: name, Key: f[0]}
+	rawURL := "https://" + name
+	if len(f) == 2 {
+		rawURL = f[1]
+	}
+	var err error
+	if sumdb.URL, err = url.Parse(rawURL); err != nil {
+		return nil, fmt.Errorf("checksum database URL is malformed: %w", err)
+	}
+	return sumdb, nil
+}
+
+// isSumDBPath reports whether path is a valid path within a checksum database which
+// can be proxied
+func isSumDBPath(path string) bool {
+	if path == "latest" {
+		return true
+	} else if strings.HasPrefix(path, "lookup/") {
+		return !strings.Contains(path, "..")
+	} else if _, err := tlog.ParseTilePath(path); err == nil {
+		return true
+	}
+	return false
+}
+
+// isImmutableTile reports whether path is a full tile, which never changes once published
+func isImmutableTile(path string) bool {
+	tile, err := tlog.ParseTilePath(path)
+	return err == nil && tile.W == 1<<tile.H
+}
+
+func (s *Server) sumDBCachePath(path string) string {
+	return filepath.Join(s.CacheDir, "sumdb", s.SumDB.Name, filepath.FromSlash(path))
+}
+
+// requestSumDB downloads the given path from the checksum database.  The credentials of
+// upstream proxies are never used.
+func (s *Server) requestSumDB(ctx context.Context, path string) ([]byte, error) {
+	url := s.SumDB.URL.JoinPath(path)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, url.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := sumDBHTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return nil, errNotFound
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(url.String() + ": " + resp.Status)
+	}
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxSumDBResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxSumDBResponseSize {
+		return nil, fmt.Errorf("%s: response exceeds maximum size of %d bytes", url, maxSumDBResponseSize)
+	}
+	return content, nil
+}
+
+// fetchSumDB returns the given path from the checksum database.  In caching mode,
+// full tiles are stored in the cache directory and served from there.
+func (s *Server) fetchSumDB(ctx context.Context, path string) ([]byte, error) {
+	cacheable := s.CacheDir != "" && isImmutableTile(path)
+	if cacheable {
+		if content, err := os.ReadFile(s.sumDBCachePath(path)); err == nil {
+			return content, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	content, err := s.requestSumDB(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if cacheable {
+		if err := createFile(s.sumDBCachePath(path), content); err != nil && !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("error storing %s in cache: %w", path, err)
+		}
+	}
+	return content, nil
+}
+
+// serveSumDBRequest implements the checksum database proxy protocol described at
+// https://go.dev/ref/mod#checksum-database, which lets clients access the checksum
+// database through depproxy
+func (s *Server) serveSumDBRequest(w http.ResponseWriter, httpReq *http.Request) {
+	name, path, _ := strings.Cut(strings.TrimPrefix(httpReq.URL.Path, "/proxy/sumdb/"), "/")
+	if s.PrivateSumDB != nil && name == s.PrivateSumDB.Name() {
+		if path == "supported" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		http.StripPrefix("/proxy/sumdb/"+name, s.privateSumDBHandler()).ServeHTTP(w, httpReq)
+		return
+	}
+	if s.SumDB == nil || name != s.SumDB.Name {
+		http.Error(w, "This checksum database is not proxied", http.StatusNotFound)
+		return
+	}
+	if path == "supported" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if !isSumDBPath(path) {
+		http.Error(w, "Invalid checksum database request", http.StatusBadRequest)
+		return
+	}
+
+	content, err := s.fetchSumDB(httpReq.Context(), path)
+	if errors.Is(err, errNotFound) {
+		http.Error(w, "Not found in checksum database", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Error communicating with checksum database: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if strings.HasPrefix(path, "tile/") {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write(content)
+}
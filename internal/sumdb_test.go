@@ -0,0 +1,168 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseSumDB(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr bool
+		name    string
+		url     string
+	}{
+		{spec: DefaultSumDB, name: "sum.golang.org", url: "https://sum.golang.org"},
+		{spec: DefaultSumDB + " https://sumdb.example.com/sumdb", name: "sum.golang.org", url: "https://sumdb.example.com/sumdb"},
+		{spec: "", wantErr: true},
+		{spec: "sum.golang.org", wantErr: true},
+		{spec: "+033de0ae", wantErr: true},
+		{spec: "a+b c d", wantErr: true},
+	}
+	for _, test := range tests {
+		sumdb, err := ParseSumDB(test.spec)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ParseSumDB(%q) succeeded, want error", test.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSumDB(%q) failed: %s", test.spec, err)
+			continue
+		}
+		if sumdb.Name != test.name || sumdb.URL.String() != test.url {
+			t.Errorf("ParseSumDB(%q) = %q %q, want %q %q", test.spec, sumdb.Name, sumdb.URL, test.name, test.url)
+		}
+	}
+}
+
+func TestIsSumDBPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"latest", true},
+		{"lookup/golang.org/x/mod@v0.25.0", true},
+		{"lookup/../secret", false},
+		{"tile/8/0/001", true},
+		{"tile/8/0/001.p/5", true},
+		{"tile/8/data/001", true},
+		{"tile/x/0/001", false},
+		{"config", false},
+	}
+	for _, test := range tests {
+		if got := isSumDBPath(test.path); got != test.want {
+			t.Errorf("isSumDBPath(%q) = %v, want %v", test.path, got, test.want)
+		}
+	}
+}
+
+func TestRequestSumDBSizeLimit(t *testing.T) {
+	tests := []struct {
+		size    int
+		wantErr bool
+	}{
+		{0, false},
+		{maxSumDBResponseSize, false},
+		{maxSumDBResponseSize + 1, true},
+	}
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Write(bytes.Repeat([]byte{'x'}, test.size))
+		}))
+		serverURL, _ := url.Parse(server.URL)
+		s := &Server{SumDB: &SumDB{Name: "sumdb.example.com", URL: serverURL}}
+		content, err := s.requestSumDB(context.Background(), "latest")
+		server.Close()
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("requestSumDB of %d bytes succeeded, want error", test.size)
+			}
+		} else if err != nil {
+			t.Errorf("requestSumDB of %d bytes failed: %s", test.size, err)
+		} else if len(content) != test.size {
+			t.Errorf("requestSumDB returned %d bytes, want %d", len(content), test.size)
+		}
+	}
+}
+
+func TestServeSumDBRequest(t *testing.T) {
+	var requests atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		switch req.URL.Path {
+		case "/latest", "/tile/8/0/000", "/tile/8/0/000.p/5":
+			fmt.Fprintf(w, "contents of %s", req.URL.Path)
+		case "/lookup/example.com/m@v1.0.0":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+	s := &Server{
+		SumDB:    &SumDB{Name: "sumdb.example.com", URL: upstreamURL},
+		CacheDir: t.TempDir(),
+	}
+
+	tests := []struct {
+		path         string
+		wantStatus   int
+		wantBody     string
+		wantRequests int32 // number of requests to the upstream, cumulative
+	}{
+		{"/proxy/sumdb/sumdb.example.com/supported", http.StatusOK, "", 0},
+		{"/proxy/sumdb/other.example.com/supported", http.StatusNotFound, "", 0},
+		{"/proxy/sumdb/sumdb.example.com/config", http.StatusBadRequest, "", 0},
+		{"/proxy/sumdb/sumdb.example.com/latest", http.StatusOK, "contents of /latest", 1},
+		{"/proxy/sumdb/sumdb.example.com/latest", http.StatusOK, "contents of /latest", 2},
+		{"/proxy/sumdb/sumdb.example.com/tile/8/0/000", http.StatusOK, "contents of /tile/8/0/000", 3},
+		{"/proxy/sumdb/sumdb.example.com/tile/8/0/000", http.StatusOK, "contents of /tile/8/0/000", 3}, // full tiles are cached
+		{"/proxy/sumdb/sumdb.example.com/tile/8/0/000.p/5", http.StatusOK, "contents of /tile/8/0/000.p/5", 4},
+		{"/proxy/sumdb/sumdb.example.com/tile/8/0/000.p/5", http.StatusOK, "contents of /tile/8/0/000.p/5", 5},
+		{"/proxy/sumdb/sumdb.example.com/tile/8/0/001", http.StatusNotFound, "", 6},
+		{"/proxy/sumdb/sumdb.example.com/lookup/example.com/m@v1.0.0", http.StatusBadGateway, "", 7},
+	}
+	for _, test := range tests {
+		rec := serveTestRequest(s, test.path)
+		if rec.Code != test.wantStatus || (test.wantBody != "" && rec.Body.String() != test.wantBody) {
+			t.Errorf("GET %s returned %d %q, want %d %q", test.path, rec.Code, rec.Body.String(), test.wantStatus, test.wantBody)
+		}
+		if n := requests.Load(); n != test.wantRequests {
+			t.Errorf("after GET %s, upstream received %d requests, want %d", test.path, n, test.wantRequests)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/mod/sumdb"
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+// Maximum number of checksum database verification failures to remember for the dashboard
+const maxSumDBFailures = 100
+
+// sumDBClientOps implements sumdb.ClientOps, storing the latest signed tree head and
+// cached lookups and tiles in a directory
+type sumDBClientOps struct {
+	server *Server
+	dir    string
+
+	configMu sync.Mutex
+}
+
+// ReadRemote downloads path from the checksum database.  sumdb.ClientOps does not
+// provide a context, so the request is bounded by sumDBRequestTimeout instead.
+func (ops *sumDBClientOps) ReadRemote(path string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sumDBRequestTimeout)
+	defer cancel()
+	return ops.server.requestSumDB(ctx, strings.TrimPrefix(path, "/"))
+}
+
+func (ops *sumDBClientOps) configPath(file string) string {
+	return filepath.Join(ops.dir, "config", filepath.FromSlash(file))
+}
+
+func (ops *sumDBClientOps) ReadConfig(file string) ([]byte, error) {
+	if file == "key" {
+		return []byte(ops.server.SumDB.Key), nil
+	}
+	data, err := os.ReadFile(ops.configPath(file))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []byte{}, nil
+	}
+	return data, err
+}
+
+func (ops *sumDBClientOps) WriteConfig(file string, old, new []byte) error {
+	ops.configMu.Lock()
+	defer ops.configMu.Unlock()
+
+	current, err := ops.ReadConfig(file)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(current, old) {
+		return sumdb.ErrWriteConflict
+	}
+	if err := os.MkdirAll(filepath.Dir(ops.configPath(file)), 0755); err != nil {
+		return err
+	}
+	return replaceFile(ops.configPath(file), new)
+}
+
+func (ops *sumDBClientOps) cachePath(file string) string {
+	return filepath.Join(ops.dir, "cache", filepath.FromSlash(file))
+}
+
+func (ops *sumDBClientOps) ReadCache(file string) ([]byte, error) {
+	return os.ReadFile(ops.cachePath(file))
+}
+
+func (ops *sumDBClientOps) WriteCache(file string, data []byte) {
+	if err := createFile(ops.cachePath(file), data); err != nil && !errors.Is(err, fs.ErrExist) {
+		log.Printf("error caching checksum database file %s: %s", file, err)
+	}
+}
+
+func (ops *sumDBClientOps) Log(msg string) {
+	log.Print(msg)
+}
+
+func (ops *sumDBClientOps) SecurityError(msg string) {
+	log.Printf("ALERT: checksum database %s is misbehaving: %s", ops.server.SumDB.Name, msg)
+}
+
+type sumDBFailure struct {
+	Path    goproxy.ModulePath
+	Version string // may end in /go.mod
+	Error   string
+	Time    time.Time
+}
+
+func (s *Server) getSumDBClient() *sumdb.Client {
+	s.sumDBClientOnce.Do(func() {
+		s.sumDBClient = sumdb.NewClient(&sumDBClientOps{server: s, dir: s.SumDBVerifierDir})
+		if s.NoSumDB != "" {
+			s.sumDBClient.SetGONOSUMDB(s.NoSumDB)
+		}
+	})
+	return s.sumDBClient
+}
+
+// checkSumDB returns an error unless the checksum database contains the given hash for the
+// given module version (whose version ends in /go.mod for go.mod hashes).  Modules matching
+// NoSumDB are not checked.
+func (s *Server) checkSumDB(module goproxy.ModulePath, version string, hash string) error {
+	lines, err := s.getSumDBClient().Lookup(module.String(), version)
+	if errors.Is(err, sumdb.ErrGONOSUMDB) {
+		return nil
+	} else if err != nil {
+		err = fmt.Errorf("checksum database lookup failed: %w", err)
+	} else if !slices.Contains(lines, module.String()+" "+version+" "+hash) {
+		err = fmt.Errorf("%s@%s has hash %s, which does not match the checksum database", module, version, hash)
+	}
+	if err != nil {
+		s.recordSumDBFailure(module, version, err)
+	}
+	return err
+}
+
+func (s *Server) recordSumDBFailure(module goproxy.ModulePath, version string, err error) {
+	log.Printf("checksum database verification of %s@%s failed: %s", module, version, err)
+
+	s.sumDBFailuresMu.Lock()
+	defer s.sumDBFailuresMu.Unlock()
+	s.sumDBFailures = append(s.sumDBFailures, sumDBFailure{
+		Path:    module,
+		Version: version,
+		Error:   err.Error(),
+		Time:    time.Now(),
+	})
+	if len(s.sumDBFailures) > maxSumDBFailures {
+		s.sumDBFailures = s.sumDBFailures[len(s.sumDBFailures)-maxSumDBFailures:]
+	}
+}
+
+// getSumDBFailures returns the recent checksum database verification failures, most recent first
+func (s *Server) getSumDBFailures() []sumDBFailure {
+	s.sumDBFailuresMu.Lock()
+	defer s.sumDBFailuresMu.Unlock()
+	failures := slices.Clone(s.sumDBFailures)
+	slices.Reverse(failures)
+	return failures
+}
+
+// needsVerification reports whether the file for req must be verified before it is served,
+// because the allowlist pins its hash or because checksum database verification is enabled
+func (s *Server) needsVerification(module goproxy.ModulePath, req goproxy.Request) bool {
+	zipHash, goModHash := s.getPinnedHashes(module, requestVersion(req))
+	switch req.(type) {
+	case goproxy.ZipRequest:
+		return zipHash != "" || s.SumDBVerifierDir != ""
+	case goproxy.ModRequest:
+		return goModHash != "" || s.SumDBVerifierDir != ""
+	default:
+		return false
+	}
+}
+
+// verifyFile returns an error unless the content of the file for req matches the hash pinned by
+// the allowlist, if any, and the checksum database, if checksum database verification is enabled
+func (s *Server) verifyFile(module goproxy.ModulePath, req goproxy.Request, content []byte) error {
+	version := requestVersion(req)
+	zipHash, goModHash := s.getPinnedHashes(module, version)
+
+	var hash, pinnedHash, sumDBVersion string
+	var err error
+	switch req.(type) {
+	case goproxy.ZipRequest:
+		hash, err = hashZipBytes(content)
+		pinnedHash, sumDBVersion = zipHash, version.String()
+	case goproxy.ModRequest:
+		hash, err = hashGoMod(content)
+		pinnedHash, sumDBVersion = goModHash, version.String()+"/go.mod"
+	default:
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error hashing %s/%s: %w", module, req.Path(), err)
+	}
+
+	if pinnedHash != "" && hash != pinnedHash {
+		return fmt.Errorf("upstream proxy served %s/%s with hash %s, but the allowlist requires %s", module, req.Path(), hash, pinnedHash)
+	}
+	if s.SumDBVerifierDir != "" {
+		if err := s.checkSumDB(module, sumDBVersion, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// newTestSumDB returns a checksum database which contains the go.sum lines returned by gosum
+func newTestSumDB(t *testing.T, gosum func(path, version string) ([]byte, error)) *SumDB {
+	t.Helper()
+	signer, verifier, err := note.GenerateKey(rand.Reader, "sumdb.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(sumdb.NewServer(sumdb.NewTestServer(signer, gosum)))
+	t.Cleanup(server.Close)
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &SumDB{Name: "sumdb.example.com", Key: verifier, URL: serverURL}
+}
+
+func TestSumDBVerification(t *testing.T) {
+	type moduleFiles struct {
+		goMod []byte
+		zip   []byte
+	}
+	modules := map[string]moduleFiles{
+		"example.com/m@v1.0.0":       {[]byte("module example.com/m\n"), makeTestZip(t, "example.com/m@v1.0.0/m.go")},
+		"example.com/m@v1.1.0":       {[]byte("module example.com/m\n"), makeTestZip(t, "example.com/m@v1.1.0/m.go")},
+		"example.com/private@v1.0.0": {[]byte("module example.com/private\n"), makeTestZip(t, "example.com/private@v1.0.0/p.go")},
+		"example.com/unknown@v1.0.0": {[]byte("module example.com/unknown\n"), makeTestZip(t, "example.com/unknown@v1.0.0/u.go")},
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		module, file, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/"), "/@v/")
+		if version, ok := strings.CutSuffix(file, ".mod"); ok && modules[module+"@"+version].goMod != nil {
+			w.Write(modules[module+"@"+version].goMod)
+		} else if version, ok := strings.CutSuffix(file, ".zip"); ok && modules[module+"@"+version].zip != nil {
+			w.Write(modules[module+"@"+version].zip)
+		} else {
+			http.NotFound(w, req)
+		}
+	}))
+	defer upstream.Close()
+
+	s := newTestServer(t, upstream.URL, "example.com/* *\n")
+	s.SumDBVerifierDir = t.TempDir()
+	s.NoSumDB = "example.com/private"
+	s.SumDB = newTestSumDB(t, func(path, version string) ([]byte, error) {
+		files, ok := modules[path+"@"+version]
+		if !ok || path == "example.com/unknown" {
+			return nil, fmt.Errorf("%s@%s not found", path, version)
+		}
+		zipHash, err := hashZipBytes(files.zip)
+		if err != nil {
+			return nil, err
+		}
+		goModHash, err := hashGoMod(files.goMod)
+		if err != nil {
+			return nil, err
+		}
+		if version == "v1.1.0" {
+			// the upstream proxy serves different content than was originally published
+			zipHash, goModHash = testHash, testHash
+		}
+		return []byte(fmt.Sprintf("%s %s %s\n%s %s/go.mod %s\n", path, version, zipHash, path, version, goModHash)), nil
+	})
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{"/proxy/example.com/m/@v/v1.0.0.mod", http.StatusOK},
+		{"/proxy/example.com/m/@v/v1.0.0.zip", http.StatusOK},
+		{"/proxy/example.com/m/@v/v1.1.0.mod", http.StatusBadGateway},
+		{"/proxy/example.com/m/@v/v1.1.0.zip", http.StatusBadGateway},
+		{"/proxy/example.com/private/@v/v1.0.0.zip", http.StatusOK},
+		{"/proxy/example.com/unknown/@v/v1.0.0.zip", http.StatusBadGateway},
+		{"/proxy/example.com/m/@v/v1.0.0.info", http.StatusSeeOther},
+	}
+	for _, test := range tests {
+		if rec := serveTestRequest(s, test.path); rec.Code != test.wantStatus {
+			t.Errorf("GET %s returned status %d, want %d", test.path, rec.Code, test.wantStatus)
+		}
+	}
+
+	failures := s.getSumDBFailures()
+	if len(failures) != 3 {
+		t.Fatalf("%d failures recorded, want 3: %v", len(failures), failures)
+	}
+	if failures[0].Path != "example.com/unknown" || failures[1].Version != "v1.1.0" || failures[2].Version != "v1.1.0/go.mod" {
+		t.Errorf("failures recorded are %v", failures)
+	}
+}
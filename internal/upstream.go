@@ -0,0 +1,135 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/mod/module"
+
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+// An UpstreamProxy is one of the module proxies in an Upstream's list
+type UpstreamProxy struct {
+	URL             *url.URL // nil if Direct is true
+	Direct          bool     // if true, modules are fetched directly from their git repositories (direct in GOPROXY)
+	FallbackOnError bool     // if true, the next proxy is tried after any error (| in GOPROXY), not just after a 404 or 410 (, in GOPROXY)
+
+	Credentials *UpstreamCredentials // if non-nil, credentials for authenticating to the proxy (see SetUpstreamCredentials)
+}
+
+// An Upstream is a list of module proxies which serves the modules matching its patterns.
+// The proxies are tried in order, like the proxies listed in GOPROXY.
+type Upstream struct {
+	Patterns string // comma-separated module path patterns, in GOPRIVATE syntax; if empty, every module matches
+	Proxies  []UpstreamProxy
+}
+
+// ParseUpstream parses an Upstream from a list of proxy URLs in GOPROXY syntax, optionally
+// preceded by comma-separated module path patterns and an equals sign, like this:
+//
+//	corp.example.com,*.corp.example.com=https://athens.example.com|https://mirror.example.com
+func ParseUpstream(str string) (*Upstream, error) {
+	upstream := new(Upstream)
+	if patterns, proxies, found := strings.Cut(str, "="); found && !strings.Contains(patterns, ":") {
+		if patterns == "" {
+			return nil, fmt.Errorf("module path patterns are empty")
+		}
+		upstream.Patterns, str = patterns, proxies
+	}
+	for str != "" {
+		var proxy UpstreamProxy
+		var rawURL string
+		if i := strings.IndexAny(str, ",|"); i >= 0 {
+			rawURL, proxy.FallbackOnError, str = str[:i], str[i] == '|', str[i+1:]
+		} else {
+			rawURL, str = str, ""
+		}
+		if rawURL == "direct" {
+			proxy.Direct = true
+			upstream.Proxies = append(upstream.Proxies, proxy)
+			continue
+		} else if rawURL == "off" {
+			return nil, fmt.Errorf("%q is not supported as an upstream proxy", rawURL)
+		}
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "file" {
+			return nil, fmt.Errorf("upstream proxy URL %q must be http, https, or file", rawURL)
+		}
+		if u.User != nil && u.Scheme != "https" {
+			return nil, fmt.Errorf("upstream proxy URL %q contains credentials, so it must be https", u.Redacted())
+		}
+		proxy.URL = u
+		upstream.Proxies = append(upstream.Proxies, proxy)
+	}
+	if len(upstream.Proxies) == 0 {
+		return nil, fmt.Errorf("no upstream proxy URLs specified")
+	}
+	return upstream, nil
+}
+
+// HasDirect reports whether any of the upstream's proxies is direct
+func (upstream *Upstream) HasDirect() bool {
+	for _, proxy := range upstream.Proxies {
+		if proxy.Direct {
+			return true
+		}
+	}
+	return false
+}
+
+func (upstream *Upstream) matches(path goproxy.ModulePath) bool {
+	return upstream.Patterns == "" || module.MatchPrefixPatterns(upstream.Patterns, path.String())
+}
+
+// getUpstream returns the first upstream whose patterns match module, or nil if none do
+func (s *Server) getUpstream(module goproxy.ModulePath) *Upstream {
+	for _, upstream := range s.Upstreams {
+		if upstream.matches(module) {
+			return upstream
+		}
+	}
+	return nil
+}
+
+// redirectableUpstream returns the URL of the upstream proxy to which clients can be redirected
+// for files of module, or nil if depproxy must fetch the files itself.  Clients can only be
+// redirected if module's upstream has a single proxy, since clients wouldn't know to fall back
+// to the other proxies, and if that proxy isn't a local directory or a git repository, and
+// doesn't require credentials.
+func (s *Server) redirectableUpstream(module goproxy.ModulePath) *url.URL {
+	upstream := s.getUpstream(module)
+	if upstream == nil || len(upstream.Proxies) != 1 || upstream.Proxies[0].Direct || isLocalUpstream(upstream.Proxies[0].URL) || upstream.Proxies[0].hasCredentials() {
+		return nil
+	}
+	return upstream.Proxies[0].URL
+}
@@ -0,0 +1,208 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Maximum time allowed for a request to an upstream proxy, including reading the response
+// body, which can be a zip file of up to 500MB
+const upstreamTimeout = 10 * time.Minute
+
+// Maximum time allowed for a request to a checksum database
+const sumDBTimeout = 1 * time.Minute
+
+// defaultUpstreamClient is used for upstream proxies without a CA bundle or client certificate
+var defaultUpstreamClient = &http.Client{Timeout: upstreamTimeout}
+
+// sumDBHTTPClient is used for checksum databases.  It never uses the CA bundles or
+// client certificates of upstream proxies.
+var sumDBHTTPClient = &http.Client{Timeout: sumDBTimeout}
+
+// UpstreamCredentials are the credentials used to authenticate to an upstream proxy, in
+// addition to any username and password in the proxy's URL.  They are only used with
+// https proxies.
+type UpstreamCredentials struct {
+	BearerToken string // if non-empty, sent as a bearer token
+	Login       string // if BearerToken is empty, Login and Password are sent using HTTP basic authentication
+	Password    string
+	RootCAs     *x509.CertPool   // if non-nil, used instead of the system's roots to verify the proxy
+	Certificate *tls.Certificate // if non-nil, presented to the proxy as a TLS client certificate
+
+	clientOnce sync.Once
+	client     *http.Client
+}
+
+// A NetrcEntry is the login and password for a machine in a .netrc file
+type NetrcEntry struct {
+	Machine  string
+	Login    string
+	Password string
+}
+
+// ReadNetrc reads the machine entries from a .netrc file.  Like the go command, it stops
+// at the default entry, which is not used.
+func ReadNetrc(r io.Reader) ([]NetrcEntry, error) {
+	var entries []NetrcEntry
+	var entry *NetrcEntry
+	inMacro := false
+	scanner := bufio.NewScanner(r)
+lines:
+	for scanner.Scan() {
+		f := strings.Fields(scanner.Text())
+		if inMacro {
+			// Macro definitions end at a blank line
+			inMacro = len(f) > 0
+			continue
+		}
+		for i := 0; i < len(f); i++ {
+			switch f[i] {
+			case "machine":
+				if i+1 < len(f) {
+					entries = append(entries, NetrcEntry{Machine: f[i+1]})
+					entry = &entries[len(entries)-1]
+					i++
+				}
+			case "default":
+				break lines
+			case "login", "password", "account":
+				if i+1 < len(f) && entry != nil {
+					if f[i] == "login" {
+						entry.Login = f[i+1]
+					} else if f[i] == "password" {
+						entry.Password = f[i+1]
+					}
+				}
+				i++
+			case "macdef":
+				inMacro = true
+				continue lines
+			}
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// SetUpstreamCredentials attaches credentials to the https proxies of upstreams, by host
+// name.  If a host has neither a bearer token nor a login in credentials, its entry in
+// netrc is used, if any.  It is an error to specify credentials for a host which isn't
+// the host of an https proxy, since credentials are never sent over plain HTTP.
+func SetUpstreamCredentials(upstreams []*Upstream, credentials map[string]*UpstreamCredentials, netrc []NetrcEntry) error {
+	used := make(map[string]bool)
+	for _, upstream := range upstreams {
+		for i := range upstream.Proxies {
+			proxy := &upstream.Proxies[i]
+			if proxy.Direct || proxy.URL.Scheme != "https" {
+				continue
+			}
+			host := proxy.URL.Hostname()
+			creds, ok := credentials[host]
+			if ok {
+				used[host] = true
+			}
+			if entry := findNetrcEntry(netrc, host); entry != nil && (creds == nil || (creds.BearerToken == "" && creds.Login == "")) {
+				if creds == nil {
+					creds = new(UpstreamCredentials)
+				}
+				creds.Login, creds.Password = entry.Login, entry.Password
+			}
+			proxy.Credentials = creds
+		}
+	}
+	for host := range credentials {
+		if !used[host] {
+			return fmt.Errorf("credentials are specified for %s, but there is no https upstream proxy on that host", host)
+		}
+	}
+	return nil
+}
+
+func findNetrcEntry(netrc []NetrcEntry, host string) *NetrcEntry {
+	for i := range netrc {
+		if strings.EqualFold(netrc[i].Machine, host) {
+			return &netrc[i]
+		}
+	}
+	return nil
+}
+
+// authorization returns the value of the Authorization header to send to the proxy, or the
+// empty string if there are no credentials for it.  Credentials are never sent over plain HTTP.
+func (proxy *UpstreamProxy) authorization() string {
+	if proxy.URL.Scheme != "https" {
+		return ""
+	}
+	req := &http.Request{Header: make(http.Header)}
+	if proxy.URL.User != nil {
+		password, _ := proxy.URL.User.Password()
+		req.SetBasicAuth(proxy.URL.User.Username(), password)
+		return req.Header.Get("Authorization")
+	}
+	if proxy.Credentials == nil {
+		return ""
+	}
+	if proxy.Credentials.BearerToken != "" {
+		return "Bearer " + proxy.Credentials.BearerToken
+	}
+	if proxy.Credentials.Login != "" || proxy.Credentials.Password != "" {
+		req.SetBasicAuth(proxy.Credentials.Login, proxy.Credentials.Password)
+		return req.Header.Get("Authorization")
+	}
+	return ""
+}
+
+// hasCredentials reports whether depproxy authenticates to the proxy.  Clients must not be
+// redirected to such a proxy, since they lack the credentials, and redirecting them to a URL
+// containing the credentials would leak the credentials.
+func (proxy *UpstreamProxy) hasCredentials() bool {
+	return proxy.URL.User != nil || proxy.Credentials != nil
+}
+
+// client returns the HTTP client for requests to the proxy
+func (proxy *UpstreamProxy) client() *http.Client {
+	creds := proxy.Credentials
+	if creds == nil || (creds.RootCAs == nil && creds.Certificate == nil) {
+		return defaultUpstreamClient
+	}
+	creds.clientOnce.Do(func() {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: creds.RootCAs}
+		if creds.Certificate != nil {
+			transport.TLSClientConfig.Certificates = []tls.Certificate{*creds.Certificate}
+		}
+		creds.client = &http.Client{Transport: transport, Timeout: upstreamTimeout}
+	})
+	return creds.client
+}
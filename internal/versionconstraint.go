@@ -0,0 +1,250 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+type versionComparator struct {
+	op      string // one of "=", "<", "<=", ">", ">="
+	version goproxy.ModuleVersion
+}
+
+func (c versionComparator) matches(version goproxy.ModuleVersion) bool {
+	cmp := version.Compare(c.version)
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	default:
+		return false
+	}
+}
+
+// A VersionConstraint is a set of comparators, all of which must be satisfied
+// by a version for the version to match.
+//
+// Prerelease versions only match if the constraint contains "+prerelease", or if
+// one of the comparators is itself a prerelease version with the same major,
+// minor, and patch numbers.  Pseudo-versions only match if the constraint contains
+// "+pseudo".
+type VersionConstraint struct {
+	text        string
+	comparators []versionComparator
+	prerelease  bool
+	pseudo      bool
+}
+
+func (c *VersionConstraint) String() string {
+	return c.text
+}
+
+func (c *VersionConstraint) MarshalText() ([]byte, error) {
+	return []byte(c.text), nil
+}
+
+func (c *VersionConstraint) Matches(version goproxy.ModuleVersion) bool {
+	if !semver.IsValid(version.String()) {
+		return false
+	}
+	if module.IsPseudoVersion(version.String()) {
+		if !c.pseudo {
+			return false
+		}
+	} else if semver.Prerelease(version.String()) != "" {
+		if !c.prerelease && !c.hasPrereleaseComparator(version) {
+			return false
+		}
+	}
+	for _, comparator := range c.comparators {
+		if !comparator.matches(version) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *VersionConstraint) hasPrereleaseComparator(version goproxy.ModuleVersion) bool {
+	core := versionCore(version.String())
+	for _, comparator := range c.comparators {
+		if semver.Prerelease(comparator.version.String()) != "" && versionCore(comparator.version.String()) == core {
+			return true
+		}
+	}
+	return false
+}
+
+// versionCore returns vMAJOR.MINOR.PATCH for the given valid semver version
+func versionCore(version string) string {
+	canonical := semver.Canonical(version)
+	return strings.TrimSuffix(canonical, semver.Prerelease(canonical))
+}
+
+// parseVersionNumbers parses a valid semver version, which may omit the minor
+// and patch numbers, into its numeric components.  The number of components
+// actually present in the version is returned as n.
+func parseVersionNumbers(version string) (numbers [3]int, n int, err error) {
+	if !semver.IsValid(version) {
+		return numbers, 0, fmt.Errorf("%q is not a valid semantic version", version)
+	}
+	core := strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(core, "-+"); i != -1 {
+		core = core[:i]
+	}
+	for i, part := range strings.Split(core, ".") {
+		numbers[i], err = strconv.Atoi(part)
+		if err != nil {
+			return numbers, 0, fmt.Errorf("%q is not a valid semantic version", version)
+		}
+		n = i + 1
+	}
+	return numbers, n, nil
+}
+
+func formatVersion(major, minor, patch int) goproxy.ModuleVersion {
+	return goproxy.ModuleVersion(fmt.Sprintf("v%d.%d.%d", major, minor, patch))
+}
+
+func makeComparatorVersion(str string) (goproxy.ModuleVersion, error) {
+	if !semver.IsValid(str) {
+		return "", fmt.Errorf("%q is not a valid semantic version", str)
+	}
+	return goproxy.ModuleVersion(semver.Canonical(str)), nil
+}
+
+func parseVersionComparators(token string) ([]versionComparator, error) {
+	switch {
+	case strings.HasSuffix(token, ".*"):
+		numbers, n, err := parseVersionNumbers(strings.TrimSuffix(token, ".*"))
+		if err != nil {
+			return nil, err
+		} else if n == 3 {
+			return nil, fmt.Errorf("%q has too many components", token)
+		} else if n == 1 {
+			return []versionComparator{
+				{op: ">=", version: formatVersion(numbers[0], 0, 0)},
+				{op: "<", version: formatVersion(numbers[0]+1, 0, 0)},
+			}, nil
+		} else {
+			return []versionComparator{
+				{op: ">=", version: formatVersion(numbers[0], numbers[1], 0)},
+				{op: "<", version: formatVersion(numbers[0], numbers[1]+1, 0)},
+			}, nil
+		}
+	case strings.HasPrefix(token, "~"):
+		lower, err := makeComparatorVersion(token[1:])
+		if err != nil {
+			return nil, err
+		}
+		numbers, n, _ := parseVersionNumbers(token[1:])
+		upper := formatVersion(numbers[0], numbers[1]+1, 0)
+		if n == 1 {
+			upper = formatVersion(numbers[0]+1, 0, 0)
+		}
+		return []versionComparator{{op: ">=", version: lower}, {op: "<", version: upper}}, nil
+	case strings.HasPrefix(token, "^"):
+		lower, err := makeComparatorVersion(token[1:])
+		if err != nil {
+			return nil, err
+		}
+		numbers, n, _ := parseVersionNumbers(token[1:])
+		var upper goproxy.ModuleVersion
+		switch {
+		case numbers[0] != 0 || n == 1:
+			upper = formatVersion(numbers[0]+1, 0, 0)
+		case numbers[1] != 0 || n == 2:
+			upper = formatVersion(0, numbers[1]+1, 0)
+		default:
+			upper = formatVersion(0, 0, numbers[2]+1)
+		}
+		return []versionComparator{{op: ">=", version: lower}, {op: "<", version: upper}}, nil
+	}
+
+	for _, op := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(token, op) {
+			version, err := makeComparatorVersion(token[len(op):])
+			if err != nil {
+				return nil, err
+			}
+			return []versionComparator{{op: op, version: version}}, nil
+		}
+	}
+
+	version, err := makeComparatorVersion(token)
+	if err != nil {
+		return nil, err
+	}
+	return []versionComparator{{op: "=", version: version}}, nil
+}
+
+// ParseVersionConstraint parses a constraint consisting of the given whitespace-separated
+// tokens.  Each token is one of:
+//
+//	>=V, >V, <=V, <V, =V, V   compare against version V
+//	~V                        at least V, but less than the next minor version (or major version if V is vMAJOR)
+//	^V                        at least V, but less than the next version that changes the leftmost non-zero number
+//	vMAJOR.*, vMAJOR.MINOR.*  any version with the given major, or major and minor, numbers
+//	+prerelease               also match prerelease versions
+//	+pseudo                   also match pseudo-versions
+func ParseVersionConstraint(tokens []string) (*VersionConstraint, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("version constraint is empty")
+	}
+	constraint := &VersionConstraint{text: strings.Join(tokens, " ")}
+	for _, token := range tokens {
+		switch token {
+		case "+prerelease":
+			constraint.prerelease = true
+		case "+pseudo":
+			constraint.pseudo = true
+		default:
+			comparators, err := parseVersionComparators(token)
+			if err != nil {
+				return nil, fmt.Errorf("invalid version constraint %q: %w", token, err)
+			}
+			constraint.comparators = append(constraint.comparators, comparators...)
+		}
+	}
+	if len(constraint.comparators) == 0 {
+		return nil, fmt.Errorf("version constraint %q does not contain any versions", constraint.text)
+	}
+	return constraint, nil
+}
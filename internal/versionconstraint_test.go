@@ -0,0 +1,152 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package depproxy
+
+import (
+	"strings"
+	"testing"
+
+	"src.agwa.name/depproxy/internal/goproxy"
+)
+
+func TestParseVersionConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		wantErr    bool
+	}{
+		{constraint: ">=v1.4.0 <v2.0.0"},
+		{constraint: "~v1.4"},
+		{constraint: "^v1.2.3"},
+		{constraint: "v1.2.*"},
+		{constraint: "v1.*"},
+		{constraint: "v1.2.3"},
+		{constraint: "=v1.2.3"},
+		{constraint: ">v1 +prerelease +pseudo"},
+		{constraint: "", wantErr: true},
+		{constraint: "+prerelease", wantErr: true},
+		{constraint: "+pseudo +prerelease", wantErr: true},
+		{constraint: ">=1.2.3", wantErr: true},
+		{constraint: "v1.2.3.*", wantErr: true},
+		{constraint: "~", wantErr: true},
+		{constraint: "^vx", wantErr: true},
+		{constraint: "!=v1.2.3", wantErr: true},
+		{constraint: "v1.2.3 +beta", wantErr: true},
+	}
+	for _, test := range tests {
+		constraint, err := ParseVersionConstraint(strings.Fields(test.constraint))
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ParseVersionConstraint(%q) succeeded, want error", test.constraint)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseVersionConstraint(%q) failed: %s", test.constraint, err)
+		} else if constraint.String() != test.constraint {
+			t.Errorf("ParseVersionConstraint(%q).String() = %q", test.constraint, constraint.String())
+		}
+	}
+}
+
+func TestVersionConstraintMatches(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    goproxy.ModuleVersion
+		want       bool
+	}{
+		{">=v1.4.0 <v2.0.0", "v1.4.0", true},
+		{">=v1.4.0 <v2.0.0", "v1.99.99", true},
+		{">=v1.4.0 <v2.0.0", "v1.3.9", false},
+		{">=v1.4.0 <v2.0.0", "v2.0.0", false},
+		{">v1.4.0", "v1.4.0", false},
+		{">v1.4.0", "v1.4.1", true},
+		{"<=v1.4.0", "v1.4.0", true},
+		{"<=v1.4.0", "v1.4.1", false},
+		{"v1.2.3", "v1.2.3", true},
+		{"v1.2.3", "v1.2.4", false},
+		{"=v1.2", "v1.2.0", true},
+
+		// ~V allows patch changes, or minor changes if V is only vMAJOR
+		{"~v1.4", "v1.4.0", true},
+		{"~v1.4", "v1.4.9", true},
+		{"~v1.4", "v1.5.0", false},
+		{"~v1.4.2", "v1.4.1", false},
+		{"~v1.4.2", "v1.4.3", true},
+		{"~v1", "v1.9.0", true},
+		{"~v1", "v2.0.0", false},
+
+		// ^V allows changes that don't modify the leftmost non-zero number
+		{"^v1.2.3", "v1.2.3", true},
+		{"^v1.2.3", "v1.9.0", true},
+		{"^v1.2.3", "v1.2.2", false},
+		{"^v1.2.3", "v2.0.0", false},
+		{"^v0.2.3", "v0.2.9", true},
+		{"^v0.2.3", "v0.3.0", false},
+		{"^v0.0.3", "v0.0.3", true},
+		{"^v0.0.3", "v0.0.4", false},
+		{"^v0", "v0.9.0", true},
+		{"^v0.0", "v0.0.9", true},
+		{"^v0.0", "v0.1.0", false},
+
+		// wildcards
+		{"v1.2.*", "v1.2.0", true},
+		{"v1.2.*", "v1.2.99", true},
+		{"v1.2.*", "v1.3.0", false},
+		{"v1.*", "v1.99.0", true},
+		{"v1.*", "v2.0.0", false},
+		{"v1.*", "v0.9.0", false},
+
+		// prerelease versions only match with +prerelease or a prerelease comparator for the same version
+		{"v1.*", "v1.3.0-rc.1", false},
+		{"v1.* +prerelease", "v1.3.0-rc.1", true},
+		{">=v1.3.0-rc.1 <v2.0.0", "v1.3.0-rc.2", true},
+		{">=v1.3.0-rc.1 <v2.0.0", "v1.4.0-rc.1", false},
+		{">=v1.3.0-rc.1 <v2.0.0", "v1.3.0-alpha", false},
+
+		// pseudo-versions only match with +pseudo
+		{"v1.*", "v1.2.4-0.20240102030405-abcdefabcdef", false},
+		{"v1.* +prerelease", "v1.2.4-0.20240102030405-abcdefabcdef", false},
+		{"v1.* +pseudo", "v1.2.4-0.20240102030405-abcdefabcdef", true},
+		{"<v1.2.4 +pseudo", "v1.2.4-0.20240102030405-abcdefabcdef", true},
+		{">=v1.2.4 +pseudo", "v1.2.4-0.20240102030405-abcdefabcdef", false},
+
+		// +incompatible versions are compared like other versions
+		{"v2.*", "v2.1.0+incompatible", true},
+
+		// invalid versions never match
+		{"v1.*", "master", false},
+		{"v1.*", "", false},
+	}
+	for _, test := range tests {
+		constraint, err := ParseVersionConstraint(strings.Fields(test.constraint))
+		if err != nil {
+			t.Fatalf("ParseVersionConstraint(%q) failed: %s", test.constraint, err)
+		}
+		if got := constraint.Matches(test.version); got != test.want {
+			t.Errorf("%q.Matches(%q) = %v, want %v", test.constraint, test.version, got, test.want)
+		}
+	}
+}
@@ -26,6 +26,8 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"flag"
 	"fmt"
@@ -33,8 +35,10 @@ import (
 	"log"
 	"net"
 	"net/http"
-	"net/url"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"src.agwa.name/go-listener"
@@ -67,24 +71,277 @@ func readAllowedModulesFile(filename string) ([]depproxy.AllowedModule, error) {
 	return depproxy.ReadAllowedModules(file)
 }
 
+func readApproversFile(filename string) (*depproxy.Approvers, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, simplifyError(err)
+	}
+	defer file.Close()
+	return depproxy.ReadApprovers(file)
+}
+
+// loadUpstreamCredentials loads the credentials for upstream proxies specified on the command
+// line.  tokens maps host names to bearer tokens, and caFiles, certFiles, and keyFiles map
+// host names to the paths of PEM files.
+func loadUpstreamCredentials(netrcFile string, tokens, caFiles, certFiles, keyFiles map[string]string) (map[string]*depproxy.UpstreamCredentials, []depproxy.NetrcEntry, error) {
+	credentials := make(map[string]*depproxy.UpstreamCredentials)
+	get := func(host string) *depproxy.UpstreamCredentials {
+		if credentials[host] == nil {
+			credentials[host] = new(depproxy.UpstreamCredentials)
+		}
+		return credentials[host]
+	}
+	var netrc []depproxy.NetrcEntry
+	if netrcFile != "" {
+		file, err := os.Open(netrcFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading .netrc file from %q: %w", netrcFile, simplifyError(err))
+		}
+		defer file.Close()
+		netrc, err = depproxy.ReadNetrc(file)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading .netrc file from %q: %w", netrcFile, err)
+		}
+	}
+	for host, token := range tokens {
+		get(host).BearerToken = token
+	}
+	for host, caFile := range caFiles {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading CA certificates from %q: %w", caFile, simplifyError(err))
+		}
+		creds := get(host)
+		creds.RootCAs, err = x509.SystemCertPool()
+		if err != nil {
+			creds.RootCAs = x509.NewCertPool()
+		}
+		if !creds.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("error reading CA certificates from %q: no certificates found", caFile)
+		}
+	}
+	for host, certFile := range certFiles {
+		keyFile, ok := keyFiles[host]
+		if !ok {
+			return nil, nil, fmt.Errorf("-upstream-cert specified for %s without -upstream-key", host)
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error loading TLS client certificate for %s: %w", host, err)
+		}
+		get(host).Certificate = &cert
+	}
+	for host := range keyFiles {
+		if _, ok := certFiles[host]; !ok {
+			return nil, nil, fmt.Errorf("-upstream-key specified for %s without -upstream-cert", host)
+		}
+	}
+	return credentials, netrc, nil
+}
+
+// hostFileFlag returns a flag function which parses arguments of the form HOST=FILEPATH into m
+func hostFileFlag(m *map[string]string) func(string) error {
+	return func(arg string) error {
+		host, filename, found := strings.Cut(arg, "=")
+		if !found || host == "" || filename == "" {
+			return errors.New("must be in the form HOST=FILEPATH")
+		}
+		if *m == nil {
+			*m = make(map[string]string)
+		}
+		(*m)[host] = filename
+		return nil
+	}
+}
+
+const allowlistPollInterval = 5 * time.Second
+
+const defaultUpstream = "https://proxy.golang.org"
+
+func allowlistFileChanged(oldInfo, newInfo os.FileInfo) bool {
+	if oldInfo == nil || newInfo == nil {
+		return oldInfo != newInfo
+	}
+	return !os.SameFile(oldInfo, newInfo) || !oldInfo.ModTime().Equal(newInfo.ModTime()) || oldInfo.Size() != newInfo.Size()
+}
+
+// allowlistPoller decides when a changed allowlist file should be reloaded.  A change is only
+// acted upon once the file is the same in two consecutive polls, so that a file which is
+// being written in place is less likely to be loaded half-written.  (Since allowlist lines
+// are independent, a truncated file would usually parse without error.)
+type allowlistPoller struct {
+	current    os.FileInfo // the file when it was last acted upon (nil if it didn't exist)
+	pending    os.FileInfo // the changed file in the previous poll, if hasPending
+	hasPending bool
+}
+
+// poll reports whether the file, which now has the given info (nil if it doesn't exist),
+// has changed and then stayed the same since the previous poll
+func (p *allowlistPoller) poll(info os.FileInfo) bool {
+	if !allowlistFileChanged(p.current, info) {
+		p.pending, p.hasPending = nil, false
+		return false
+	}
+	if !p.hasPending || allowlistFileChanged(p.pending, info) {
+		p.pending, p.hasPending = info, true
+		return false
+	}
+	p.current, p.pending, p.hasPending = info, nil, false
+	return true
+}
+
+// reset records that the file, which now has the given info, has been acted upon
+func (p *allowlistPoller) reset(info os.FileInfo) {
+	p.current, p.pending, p.hasPending = info, nil, false
+}
+
+func reloadAllowlist(server *depproxy.Server, filename string) {
+	allowedModules, err := readAllowedModulesFile(filename)
+	if err != nil {
+		log.Printf("error reloading allowlist file from %q (continuing to use previous allowlist): %s", filename, err)
+		server.AllowlistLoadFailed()
+		return
+	}
+	server.SetAllowedModules(allowedModules)
+	log.Printf("reloaded allowlist file from %q (%d entries)", filename, len(allowedModules))
+}
+
+// watchAllowlist reloads the allowlist when SIGHUP is received or when
+// the file's modification time, size, or identity changes and then stays
+// the same for one poll interval.  The file is polled rather than watched
+// so that editors which replace the file via rename are handled without
+// special cases.
+func watchAllowlist(server *depproxy.Server, filename string, fileInfo os.FileInfo) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	ticker := time.NewTicker(allowlistPollInterval)
+	defer ticker.Stop()
+
+	poller := allowlistPoller{current: fileInfo}
+	for {
+		select {
+		case <-sighup:
+			fileInfo, _ = os.Stat(filename)
+			poller.reset(fileInfo)
+		case <-ticker.C:
+			fileInfo, _ = os.Stat(filename)
+			if !poller.poll(fileInfo) {
+				continue
+			}
+			if fileInfo == nil {
+				log.Printf("allowlist file %q has disappeared; continuing to use previous allowlist", filename)
+				continue
+			}
+		}
+		reloadAllowlist(server, filename)
+	}
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "allowlist" {
+		allowlistMain(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "sumdb" {
+		sumdbMain(os.Args[2:])
+		return
+	}
+
 	var flags struct {
-		allowlist string
-		listen    []string
-		upstream  string
+		allowlist      string
+		listen         []string
+		upstreams      []*depproxy.Upstream
+		minAge         time.Duration
+		blockRetracted bool
+		allowLicenses  []string
+		denyLicenses   []string
+		approvers      string
+		auditLog       string
+		cacheDir       string
+		sumDB          string
+		verifySumDB    string
+		noSumDB        string
+		privateSumDB   string
+		privateKey     string
+		gitRewrites    []depproxy.GitRewrite
+		gitDir         string
+		netrc          string
+		upstreamTokens map[string]string
+		upstreamCAs    map[string]string
+		upstreamCerts  map[string]string
+		upstreamKeys   map[string]string
 	}
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
 		flag.PrintDefaults()
 		fmt.Fprintf(flag.CommandLine.Output(), "Each line of the allowlist file must contain a module pattern and version pattern, separated by whitespace\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "For go-listener syntax, see https://pkg.go.dev/src.agwa.name/go-listener#readme-listener-syntax\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "To generate an allowlist from go.mod, go.sum, and go.work files, run: %s allowlist generate -help\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "To generate a key for the private checksum database, run: %s sumdb generate-key -help\n", os.Args[0])
 	}
 	flag.StringVar(&flags.allowlist, "allowlist", "", "Path to allowed modules list")
 	flag.Func("listen", "Socket to listen on, in go-listener syntax (repeatable)", func(arg string) error {
 		flags.listen = append(flags.listen, arg)
 		return nil
 	})
-	flag.StringVar(&flags.upstream, "upstream", "https://proxy.golang.org", "URL of upstream module proxy")
+	flag.Func("upstream", "Upstream module proxy URLs, in GOPROXY syntax, optionally preceded by comma-separated module path patterns and = (repeatable; the first whose patterns match a module is used) (default https://proxy.golang.org)", func(arg string) error {
+		upstream, err := depproxy.ParseUpstream(arg)
+		if err != nil {
+			return err
+		}
+		flags.upstreams = append(flags.upstreams, upstream)
+		return nil
+	})
+	flag.Func("min-age", "Only allow versions published at least this long ago (e.g. 72h or 7d)", func(arg string) (err error) {
+		flags.minAge, err = depproxy.ParseAge(arg)
+		return err
+	})
+	flag.BoolVar(&flags.blockRetracted, "block-retracted", false, "Refuse versions which have been retracted by their module's author")
+	flag.Func("allow-licenses", "Comma-separated list of SPDX license identifiers; refuse modules with any other license", func(arg string) error {
+		flags.allowLicenses = strings.Split(arg, ",")
+		return nil
+	})
+	flag.Func("deny-licenses", "Comma-separated list of SPDX license identifiers; refuse modules with any of these licenses", func(arg string) error {
+		flags.denyLicenses = strings.Split(arg, ",")
+		return nil
+	})
+	flag.StringVar(&flags.approvers, "approvers", "", "Path to file of users who may approve new versions in the web interface")
+	flag.StringVar(&flags.auditLog, "audit-log", "", "Path to file to append audit records to, in JSON Lines format (- for stdout)")
+	flag.StringVar(&flags.cacheDir, "cache", "", "Path to directory in which to store allowed module versions, which are then served directly instead of redirecting to the upstream proxy")
+	flag.StringVar(&flags.sumDB, "sumdb", depproxy.DefaultSumDB, "Checksum database to proxy, in GOSUMDB syntax (KEY [URL]), or off")
+	flag.StringVar(&flags.verifySumDB, "verify-sumdb", "", "Verify zip and go.mod files against the checksum database, storing the verifier's state in this directory")
+	flag.StringVar(&flags.noSumDB, "nosumdb", "", "Comma-separated module path patterns, in GONOSUMDB syntax, to exclude from checksum database verification")
+	flag.StringVar(&flags.privateSumDB, "private-sumdb", "", "Path to directory in which to store a private checksum database of served versions, which is served under /sumdb/")
+	flag.StringVar(&flags.privateKey, "private-sumdb-key", "", "Path to signing key for the private checksum database (generate with: "+os.Args[0]+" sumdb generate-key)")
+	flag.Func("git-rewrite", "Map module paths beginning with PREFIX to git repository URLs beginning with URL, in the form PREFIX=URL, for direct upstreams (repeatable)", func(arg string) error {
+		rewrite, err := depproxy.ParseGitRewrite(arg)
+		if err != nil {
+			return err
+		}
+		flags.gitRewrites = append(flags.gitRewrites, rewrite)
+		return nil
+	})
+	flag.StringVar(&flags.gitDir, "git-dir", "", "Path to directory in which to store clones of git repositories for direct upstreams")
+	flag.StringVar(&flags.netrc, "netrc", "", "Path to .netrc file containing credentials for upstream proxies")
+	flag.Func("upstream-token", "Authenticate to upstream proxies on HOST with the bearer token in FILEPATH, in the form HOST=FILEPATH (repeatable)", func(arg string) error {
+		host, filename, found := strings.Cut(arg, "=")
+		if !found || host == "" || filename == "" {
+			return errors.New("must be in the form HOST=FILEPATH")
+		}
+		token, err := os.ReadFile(filename)
+		if err != nil {
+			return simplifyError(err)
+		}
+		if flags.upstreamTokens == nil {
+			flags.upstreamTokens = make(map[string]string)
+		}
+		flags.upstreamTokens[host] = strings.TrimSpace(string(token))
+		return nil
+	})
+	flag.Func("upstream-ca", "Trust the CA certificates in the PEM file FILEPATH, in addition to the system's, when connecting to upstream proxies on HOST, in the form HOST=FILEPATH (repeatable)", hostFileFlag(&flags.upstreamCAs))
+	flag.Func("upstream-cert", "Present the TLS client certificate chain in the PEM file FILEPATH to upstream proxies on HOST, in the form HOST=FILEPATH (repeatable)", hostFileFlag(&flags.upstreamCerts))
+	flag.Func("upstream-key", "Path to PEM file of private key for -upstream-cert, in the form HOST=FILEPATH (repeatable)", hostFileFlag(&flags.upstreamKeys))
 	flag.Parse()
 
 	if flags.allowlist == "" {
@@ -93,22 +350,103 @@ func main() {
 	if len(flags.listen) == 0 {
 		usageError("At least one -listen flag required")
 	}
+	if (flags.privateSumDB == "") != (flags.privateKey == "") {
+		usageError("-private-sumdb and -private-sumdb-key must be specified together")
+	}
 
+	allowlistInfo, _ := os.Stat(flags.allowlist)
 	allowedModules, err := readAllowedModulesFile(flags.allowlist)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error reading allowlist file from %q: %s\n", flags.allowlist, err)
 		os.Exit(1)
 	}
-	upstreamProxy, err := url.Parse(flags.upstream)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error parsing upstream proxy URL %q: %s\n", flags.upstream, err)
-		os.Exit(1)
+	if len(flags.upstreams) == 0 {
+		upstream, err := depproxy.ParseUpstream(defaultUpstream)
+		if err != nil {
+			panic(err)
+		}
+		flags.upstreams = append(flags.upstreams, upstream)
+	}
+
+	for _, upstream := range flags.upstreams {
+		if upstream.HasDirect() && flags.gitDir == "" {
+			usageError("-git-dir flag required when an upstream is direct")
+		}
+		if upstream.HasDirect() && len(flags.gitRewrites) == 0 {
+			usageError("At least one -git-rewrite flag required when an upstream is direct")
+		}
 	}
 
 	server := &depproxy.Server{
-		AllowedModules: allowedModules,
-		UpstreamProxy:  upstreamProxy,
+		Upstreams:      flags.upstreams,
+		MinAge:         flags.minAge,
+		BlockRetracted: flags.blockRetracted,
+		AllowlistFile:  flags.allowlist,
+		CacheDir:       flags.cacheDir,
+		GitRewrites:    flags.gitRewrites,
+		GitDir:         flags.gitDir,
+	}
+	if flags.sumDB != "off" {
+		server.SumDB, err = depproxy.ParseSumDB(flags.sumDB)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error parsing checksum database %q: %s\n", flags.sumDB, err)
+			os.Exit(1)
+		}
+	}
+	if flags.verifySumDB != "" {
+		if server.SumDB == nil {
+			usageError("-verify-sumdb cannot be used with -sumdb off")
+		}
+		server.SumDBVerifierDir = flags.verifySumDB
+		server.NoSumDB = flags.noSumDB
+	}
+	upstreamCredentials, netrc, err := loadUpstreamCredentials(flags.netrc, flags.upstreamTokens, flags.upstreamCAs, flags.upstreamCerts, flags.upstreamKeys)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := depproxy.SetUpstreamCredentials(flags.upstreams, upstreamCredentials, netrc); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if flags.privateSumDB != "" {
+		signer, err := readSumDBKeyFile(flags.privateKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading private checksum database key from %q: %s\n", flags.privateKey, err)
+			os.Exit(1)
+		}
+		server.PrivateSumDB, err = depproxy.OpenPrivateSumDB(flags.privateSumDB, signer)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error opening private checksum database in %q: %s\n", flags.privateSumDB, err)
+			os.Exit(1)
+		}
+	}
+	if flags.auditLog == "-" {
+		server.AuditLog = os.Stdout
+	} else if flags.auditLog != "" {
+		auditLog, err := os.OpenFile(flags.auditLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error opening audit log file %q: %s\n", flags.auditLog, simplifyError(err))
+			os.Exit(1)
+		}
+		defer auditLog.Close()
+		server.AuditLog = auditLog
+	}
+	if flags.approvers != "" {
+		server.Approvers, err = readApproversFile(flags.approvers)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading approvers file from %q: %s\n", flags.approvers, err)
+			os.Exit(1)
+		}
+	}
+	if len(flags.allowLicenses) > 0 || len(flags.denyLicenses) > 0 {
+		server.LicensePolicy = &depproxy.LicensePolicy{
+			Allowed: flags.allowLicenses,
+			Denied:  flags.denyLicenses,
+		}
 	}
+	server.SetAllowedModules(allowedModules)
+	go watchAllowlist(server, flags.allowlist, allowlistInfo)
 
 	httpServer := http.Server{
 		ReadTimeout:  15 * time.Second,
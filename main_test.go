@@ -0,0 +1,183 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"src.agwa.name/depproxy/internal"
+)
+
+func TestAllowlistFileChanged(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "allowlist")
+	otherFilename := filepath.Join(dir, "other")
+	write := func(filename, content string, mtime time.Time) os.FileInfo {
+		t.Helper()
+		if err := os.WriteFile(filename, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(filename, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	original := write(filename, "example.com/a *\n", mtime)
+	sameInfo, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		oldInfo os.FileInfo
+		newInfo os.FileInfo
+		want    bool
+	}{
+		{"both missing", nil, nil, false},
+		{"created", nil, original, true},
+		{"removed", original, nil, true},
+		{"unchanged", original, sameInfo, false},
+		{"other file", original, write(otherFilename, "example.com/a *\n", mtime), true},
+		{"modification time", original, write(filename, "example.com/b *\n", mtime.Add(time.Second)), true},
+		{"size", original, write(filename, "example.com/bb *\n", mtime), true},
+	}
+	for _, test := range tests {
+		if got := allowlistFileChanged(test.oldInfo, test.newInfo); got != test.want {
+			t.Errorf("%s: allowlistFileChanged = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestAllowlistPoller(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "allowlist")
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// Each step changes the file (if content is non-empty or remove is true) and then polls
+	tests := []struct {
+		content string
+		remove  bool
+		want    bool
+	}{
+		{content: "example.com/a *\n", want: false}, // changed
+		{want: true},                            // stable
+		{want: false},                           // unchanged
+		{content: "example.com/a", want: false}, // half-written
+		{content: "example.com/a *\nexample.com/b", want: false},
+		{content: "example.com/a *\nexample.com/b *\n", want: false},
+		{want: true},
+		{remove: true, want: false},
+		{want: true},
+		{want: false},
+	}
+	var poller allowlistPoller
+	for i, test := range tests {
+		if test.content != "" {
+			mtime = mtime.Add(time.Second)
+			if err := os.WriteFile(filename, []byte(test.content), 0666); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(filename, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if test.remove {
+			if err := os.Remove(filename); err != nil {
+				t.Fatal(err)
+			}
+		}
+		info, _ := os.Stat(filename)
+		if got := poller.poll(info); got != test.want {
+			t.Errorf("step %d: poll = %v, want %v", i, got, test.want)
+		}
+	}
+}
+
+func TestReloadAllowlist(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	filename := filepath.Join(t.TempDir(), "allowlist")
+	upstream, err := depproxy.ParseUpstream("https://proxy.golang.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &depproxy.Server{Upstreams: []*depproxy.Upstream{upstream}}
+	server.SetAllowedModules([]depproxy.AllowedModule{})
+
+	tests := []struct {
+		content string
+		want    map[string]int // request path -> status
+	}{
+		{
+			content: "example.com/a v1.0.0\n",
+			want: map[string]int{
+				"/proxy/example.com/a/@v/v1.0.0.zip": http.StatusSeeOther,
+				"/proxy/example.com/b/@v/v1.0.0.zip": http.StatusForbidden,
+			},
+		},
+		{
+			content: "example.com/b v1.0.0\n",
+			want: map[string]int{
+				"/proxy/example.com/a/@v/v1.0.0.zip": http.StatusForbidden,
+				"/proxy/example.com/b/@v/v1.0.0.zip": http.StatusSeeOther,
+			},
+		},
+		{
+			// the previous allowlist continues to be used
+			content: "example.com/a v1.0.0\nexample.com/c\n",
+			want: map[string]int{
+				"/proxy/example.com/a/@v/v1.0.0.zip": http.StatusForbidden,
+				"/proxy/example.com/b/@v/v1.0.0.zip": http.StatusSeeOther,
+			},
+		},
+	}
+	for i, test := range tests {
+		if err := os.WriteFile(filename, []byte(test.content), 0666); err != nil {
+			t.Fatal(err)
+		}
+		reloadAllowlist(server, filename)
+		for path, want := range test.want {
+			rec := httptest.NewRecorder()
+			server.HTTPHandler().ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+			if rec.Code != want {
+				t.Errorf("step %d: GET %s returned %d, want %d", i, path, rec.Code, want)
+			}
+		}
+	}
+}
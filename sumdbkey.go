@@ -0,0 +1,88 @@
+// Copyright (C) 2026 Andrew Ayer
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL
+// THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// Except as contained in this notice, the name(s) of the above copyright
+// holders shall not be used in advertising or otherwise to promote the
+// sale, use or other dealings in this Software without prior written
+// authorization.
+
+package main
+
+import (
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/mod/sumdb/note"
+)
+
+func generateSumDBKeyMain(args []string) {
+	flagSet := flag.NewFlagSet("sumdb generate-key", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: %s sumdb generate-key NAME KEYFILE\n", os.Args[0])
+		fmt.Fprintf(flagSet.Output(), "Generate a signing key for the private checksum database, write it to KEYFILE, and print the verifier key for use in GOSUMDB\n")
+		flagSet.PrintDefaults()
+	}
+	flagSet.Parse(args)
+
+	if flagSet.NArg() != 2 {
+		flagSet.Usage()
+		os.Exit(2)
+	}
+	name, keyFile := flagSet.Arg(0), flagSet.Arg(1)
+
+	signerKey, verifierKey, err := note.GenerateKey(rand.Reader, name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error generating key: %s\n", err)
+		os.Exit(1)
+	}
+	file, err := os.OpenFile(keyFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error creating key file %q: %s\n", keyFile, simplifyError(err))
+		os.Exit(1)
+	}
+	if _, err := fmt.Fprintln(file, signerKey); err != nil {
+		fmt.Fprintf(os.Stderr, "error writing key file %q: %s\n", keyFile, err)
+		os.Exit(1)
+	}
+	if err := file.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "error writing key file %q: %s\n", keyFile, err)
+		os.Exit(1)
+	}
+	fmt.Println(verifierKey)
+}
+
+func readSumDBKeyFile(filename string) (note.Signer, error) {
+	key, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, simplifyError(err)
+	}
+	return note.NewSigner(strings.TrimSpace(string(key)))
+}
+
+func sumdbMain(args []string) {
+	if len(args) == 0 || args[0] != "generate-key" {
+		fmt.Fprintf(os.Stderr, "Usage: %s sumdb generate-key NAME KEYFILE\n", os.Args[0])
+		os.Exit(2)
+	}
+	generateSumDBKeyMain(args[1:])
+}